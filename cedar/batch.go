@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/lib/pq"
+
+	"checktable"
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// batchCheck is one line of a --batch file
+type batchCheck struct {
+	Line     int
+	User     string `json:"user"`
+	Action   string `json:"action"`
+	Document string `json:"document"`
+	Err      error  // set when the line couldn't be parsed
+}
+
+// readBatch reads "userID,action,documentID" CSV lines, or JSONL objects
+// with user, action and document keys. Both can be mixed; blank lines and
+// lines starting with # are skipped. Malformed lines are returned with Err
+// set, so they count as errors instead of aborting the batch.
+func readBatch(r io.Reader) ([]batchCheck, error) {
+	var checks []batchCheck
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		check := batchCheck{Line: number}
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &check); err != nil {
+				check.Err = fmt.Errorf("invalid JSON: %w", err)
+			}
+		} else if fields := strings.Split(line, ","); len(fields) == 3 {
+			check.User = strings.TrimSpace(fields[0])
+			check.Action = strings.TrimSpace(fields[1])
+			check.Document = strings.TrimSpace(fields[2])
+		} else {
+			check.Err = fmt.Errorf("expected userID,action,documentID, got %d fields", len(fields))
+		}
+		if check.Err == nil && (check.User == "" || check.Action == "" || check.Document == "") {
+			check.Err = fmt.Errorf("user, action and document are all required")
+		}
+		checks = append(checks, check)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch: %w", err)
+	}
+	return checks, nil
+}
+
+// userData is the principal's part of EntityData
+type userData struct {
+	Organization string
+	IsAdmin      bool
+	Groups       []string
+}
+
+// userKey identifies the principal's part of the EntityData of a document:
+// a member of several organizations gets the document's
+type userKey struct {
+	userID      string
+	documentOrg string
+}
+
+// queryUserData loads the principal's organization, admin flag and groups
+// for a document of documentOrg, the same way the user organization and
+// user_group_ids columns of postgresRepository.GetEntityData do
+func queryUserData(ctx context.Context, db *sql.DB, userID, documentOrg string) (*userData, error) {
+	query := `
+	SELECT uo.organization_id, COALESCE(uo.is_admin, false),
+		ARRAY(SELECT group_id FROM group_members WHERE user_id = $1 ORDER BY group_id)
+	FROM (SELECT 1) AS one
+	LEFT JOIN (
+		SELECT organization_id, is_admin
+		FROM organization_members
+		WHERE user_id = $1
+		ORDER BY organization_id = $2 DESC, organization_id
+		LIMIT 1
+	) uo ON true
+	`
+	var org sql.NullString
+	var user userData
+	var groups pq.StringArray
+	if err := db.QueryRowContext(ctx, query, userID, documentOrg).Scan(&org, &user.IsAdmin, &groups); err != nil {
+		return nil, fmt.Errorf("user query failed: %w", err)
+	}
+	user.Organization = org.String
+	user.Groups = groups
+	return &user, nil
+}
+
+// withUser returns a copy of data for another principal
+func withUser(data *cedarauthz.EntityData, user *userData) *cedarauthz.EntityData {
+	copied := *data
+	copied.UserOrganization = user.Organization
+	copied.UserIsAdmin = user.IsAdmin
+	copied.UserGroups = user.Groups
+	return &copied
+}
+
+// batchRunner runs the checks of a --batch file against one database
+// connection and one policy set. Entity data is cached per document and the
+// principal's part once per distinct user, so repeated documents cost a
+// single query while they stay in the cache. The principal's part is cached
+// per organization of the documents it is checked on. Emails and names are
+// resolved once per distinct identifier.
+type batchRunner struct {
+	db             *sql.DB
+	policySet      *cedar.PolicySet
+	schema         *cedarload.Schema
+	by             string
+	repo           EntityRepository
+	namespace      cedarauthz.Namespace
+	build          entityBuilder
+	strict         bool // fail principals with no organization, like --strict
+	limits         entityLimits
+	at             time.Time // zero for now
+	requestContext cedar.RecordMap
+	entitiesPath   string
+	explain        bool
+
+	documents *entityCache
+	users     map[userKey]*userData
+	resolved  map[string]string // --by identifiers already resolved to user IDs
+	warned    map[string]bool   // actions already checked for a permit
+}
+
+// batchOutcome is the result of one batchCheck
+type batchOutcome struct {
+	UserID    string
+	Verb      string
+	Result    checkResult
+	Allowed   bool
+	Err       error
+	Latency   time.Duration
+	Rationale *explanation
+}
+
+// run performs a single check; errors are returned in the outcome
+func (b *batchRunner) run(ctx context.Context, check batchCheck) batchOutcome {
+	start := time.Now()
+	outcome := batchOutcome{UserID: check.User, Verb: check.Action}
+	outcome.Result = checkResult{
+		Principal: cedar.NewEntityUID(b.namespace.User(), cedar.String(check.User)).String(),
+		Action:    check.Action,
+		Resource:  cedar.NewEntityUID(b.namespace.Document(), cedar.String(check.Document)).String(),
+		Decision:  "error",
+		Line:      check.Line,
+	}
+	fail := func(err error) batchOutcome {
+		outcome.Err = err
+		outcome.Result.Error = err.Error()
+		outcome.Latency = time.Since(start)
+		return outcome
+	}
+	if check.Err != nil {
+		return fail(check.Err)
+	}
+
+	action, verb, err := parseDocumentAction(b.schema, check.Action)
+	if err != nil {
+		return fail(err)
+	}
+	actionUID := cedar.NewEntityUID(b.namespace.Action(), cedar.String(action))
+	outcome.Verb = verb
+	outcome.Result.Action = actionUID.String()
+	b.warnWithoutPermit(actionUID)
+
+	userID := check.User
+	if b.db != nil {
+		if userID, err = b.resolveUserID(ctx, check.User); err != nil {
+			return fail(fmt.Errorf("failed to resolve user: %w", err))
+		}
+		outcome.UserID = userID
+		outcome.Result.Principal = cedar.NewEntityUID(b.namespace.User(), cedar.String(userID)).String()
+	}
+	slice, err := b.entitySlice(ctx, userID, check.Document)
+	if err != nil {
+		return fail(err)
+	}
+
+	allowed, diagnostic, err := checkAuthorization(b.policySet, slice, actionUID, b.requestContext)
+	if err != nil {
+		return fail(fmt.Errorf("authorization failed: %w", err))
+	}
+	outcome.Allowed = allowed
+	outcome.Result.Decision = "deny"
+	if allowed {
+		outcome.Result.Decision = "allow"
+	}
+	if b.explain {
+		outcome.Rationale = explainDecision(b.policySet, allowed, diagnostic)
+		outcome.Result.Explanation = outcome.Rationale
+	}
+	outcome.Latency = time.Since(start)
+	return outcome
+}
+
+// resolveUserID is resolveUserID with the IDs of earlier lines cached; lines
+// that fail to resolve are looked up again
+func (b *batchRunner) resolveUserID(ctx context.Context, identifier string) (string, error) {
+	if userID, ok := b.resolved[identifier]; ok {
+		return userID, nil
+	}
+	userID, err := resolveUserID(ctx, b.db, identifier, b.by)
+	if err != nil {
+		return "", err
+	}
+	b.resolved[identifier] = userID
+	return userID, nil
+}
+
+// entitySlice builds the entities for a check from the cached document data
+func (b *batchRunner) entitySlice(ctx context.Context, userID, documentID string) (*entitySlice, error) {
+	if b.entitiesPath != "" {
+		return loadEntitySlice(b.namespace, b.entitiesPath, userID, documentID, b.limits)
+	}
+
+	data, err := b.documentData(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	return b.sliceFromData(ctx, userID, documentID, data)
+}
+
+// documentData returns the cached data of documentID, querying it for
+// userID when it isn't cached
+func (b *batchRunner) documentData(ctx context.Context, userID, documentID string) (*cedarauthz.EntityData, error) {
+	data, ok := b.documents.get(documentID)
+	if ok {
+		return data, nil
+	}
+	data, err := b.repo.GetEntityData(ctx, userID, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entity data: %w", err)
+	}
+	b.documents.put(documentID, data)
+	b.users[userKey{userID, data.DocumentOrg}] = &userData{Organization: data.UserOrganization, IsAdmin: data.UserIsAdmin, Groups: data.UserGroups}
+	return data, nil
+}
+
+// sliceFromData builds the entities for a check from queried document data,
+// with the principal's part of userID swapped in
+func (b *batchRunner) sliceFromData(ctx context.Context, userID, documentID string, data *cedarauthz.EntityData) (*entitySlice, error) {
+	key := userKey{userID, data.DocumentOrg}
+	user, ok := b.users[key]
+	if !ok {
+		var err error
+		user, err = queryUserData(ctx, b.db, userID, data.DocumentOrg)
+		if err != nil {
+			return nil, err
+		}
+		b.users[key] = user
+	}
+	if b.strict {
+		if err := requireOrganization(user.Organization, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := b.at
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return buildEntitySlice(b.namespace, b.build, activeEntityData(withUser(data, user), now), userID, documentID, b.limits)
+}
+
+// warnWithoutPermit logs, once per action, when no permit can apply to it
+func (b *batchRunner) warnWithoutPermit(actionUID cedar.EntityUID) {
+	if b.warned[actionUID.String()] {
+		return
+	}
+	b.warned[actionUID.String()] = true
+	permits, err := permitsForAction(b.policySet, actionUID)
+	if err == nil && len(permits) == 0 {
+		log.Printf("⚠️  No permit policy applies to %s; every request for it will be denied", actionUID)
+	}
+}
+
+// runBatch runs every check of the batch file at path and prints one
+// decision per line followed by a summary. It reports whether every line
+// was decided without an error.
+func runBatch(ctx context.Context, runner *batchRunner, path, output string, columnWidth int, color bool) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open batch: %w", err)
+	}
+	defer f.Close()
+	checks, err := readBatch(f)
+	if err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	var allowed, denied, errored int
+	result := &checktable.Table{Header: checktable.Columns, MaxWidth: columnWidth, Color: color}
+	for _, check := range checks {
+		outcome := runner.run(ctx, check)
+		switch {
+		case outcome.Err != nil:
+			errored++
+		case outcome.Allowed:
+			allowed++
+		default:
+			denied++
+		}
+
+		switch output {
+		case "json":
+			encoded, err := json.Marshal(outcome.Result)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode result: %w", err)
+			}
+			fmt.Println(string(encoded))
+		case "table":
+			decision := "ERROR"
+			if outcome.Err == nil {
+				decision = strings.ToUpper(outcome.Result.Decision)
+			}
+			result.Rows = append(result.Rows, []string{decision, "cedar", outcome.UserID, check.Document, outcome.Verb, checktable.FormatLatency(outcome.Latency)})
+		default:
+			switch {
+			case outcome.Err != nil:
+				fmt.Printf("⚠️  ERROR line %d: %v\n", check.Line, outcome.Err)
+			case outcome.Allowed:
+				fmt.Printf("✅ ALLOWED: %s can %s %s\n", outcome.UserID, outcome.Verb, check.Document)
+			default:
+				fmt.Printf("❌ DENIED: %s cannot %s %s\n", outcome.UserID, outcome.Verb, check.Document)
+			}
+			if outcome.Rationale != nil {
+				fmt.Println(outcome.Rationale)
+			}
+		}
+	}
+	if output == "table" {
+		if err := result.Write(os.Stdout); err != nil {
+			return false, fmt.Errorf("failed to print results: %w", err)
+		}
+	}
+
+	// Keep stdout parseable in JSON mode
+	summary := os.Stdout
+	if output == "json" {
+		summary = os.Stderr
+	}
+	queried := ""
+	if runner.db != nil {
+		hits, misses := runner.documents.stats()
+		queried = fmt.Sprintf(" (%d documents queried, %d cache hits)", misses, hits)
+	}
+	fmt.Fprintf(summary, "📊 Batch: %d checks in %s: %d allowed, %d denied, %d errored%s\n",
+		len(checks), checktable.FormatLatency(time.Since(start)), allowed, denied, errored, queried)
+	return errored == 0, nil
+}
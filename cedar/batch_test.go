@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+func TestBatchRunnerResolvesEachUserOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Only the first line may look the email up
+	mock.ExpectQuery("FROM users WHERE lower\\(email\\)").WithArgs("charlie@techcorp.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow("charlie", "Charlie", "charlie@techcorp.com"))
+
+	policySet, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := cedarload.LoadSchema(os.DirFS("."), "schema.cedarschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &batchRunner{
+		db:             db,
+		policySet:      policySet,
+		schema:         schema,
+		by:             identifierEmail,
+		namespace:      cedarauthz.DefaultNamespace,
+		build:          cedarauthz.BuildEntities,
+		requestContext: cedar.RecordMap{},
+		entitiesPath:   "testdata/dump-entities-charlie-doc2.json",
+		users:          make(map[userKey]*userData),
+		resolved:       make(map[string]string),
+		warned:         make(map[string]bool),
+	}
+
+	for line, action := range []string{"view", "edit", "view"} {
+		outcome := runner.run(context.Background(), batchCheck{Line: line + 1, User: "charlie@techcorp.com", Action: action, Document: "doc2"})
+		if outcome.Err != nil {
+			t.Fatalf("line %d: %v", line+1, outcome.Err)
+		}
+		if outcome.UserID != "charlie" {
+			t.Errorf("line %d resolved to %q, want charlie", line+1, outcome.UserID)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A member of two organizations gets the organization of each document, and
+// each pair is queried once
+func TestBatchRunnerUserInTwoOrganizations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	userColumns := []string{"organization_id", "is_admin", "groups"}
+	for _, org := range []string{"org2", "org1"} {
+		mock.ExpectQuery("ORDER BY organization_id = \\$2 DESC, organization_id").WithArgs("zoe", org).
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow(org, org == "org1", "{}"))
+	}
+
+	runner := &batchRunner{
+		db:        db,
+		namespace: cedarauthz.DefaultNamespace,
+		build:     cedarauthz.BuildEntities,
+		users:     make(map[userKey]*userData),
+	}
+	doc1 := fixtureEntityData("alice", "doc1")
+	doc7 := fixtureEntityData("mallory", "doc7")
+	for _, data := range []*cedarauthz.EntityData{doc7, doc1, doc7, doc1} {
+		if _, err := runner.sliceFromData(context.Background(), "zoe", data.DocumentID, data); err != nil {
+			t.Fatal(err)
+		}
+		user := runner.users[userKey{"zoe", data.DocumentOrg}]
+		if user.Organization != data.DocumentOrg || user.IsAdmin != (data.DocumentOrg == "org1") {
+			t.Errorf("%s: got %+v for zoe", data.DocumentID, user)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
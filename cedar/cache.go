@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// entityCache is an LRU cache of queried EntityData keyed by document ID.
+// Entries hold the document, folder and permission data of the document; the
+// principal's part is swapped in per check with withUser, and users are
+// cached separately by the batch runner. It is safe for concurrent use.
+type entityCache struct {
+	ttl        time.Duration // 0 keeps entries until they are evicted
+	maxEntries int           // 0 for no bound
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+
+	hits, misses int
+}
+
+type cacheEntry struct {
+	documentID string
+	data       *cedarauthz.EntityData
+	storedAt   time.Time
+}
+
+func newEntityCache(ttl time.Duration, maxEntries int) *entityCache {
+	return &entityCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached data of documentID, counting a hit or a miss.
+// Expired entries are dropped and count as misses.
+func (c *entityCache) get(documentID string) (*cedarauthz.EntityData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[documentID]
+	if ok && c.ttl > 0 && c.now().Sub(element.Value.(*cacheEntry).storedAt) >= c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, documentID)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).data, true
+}
+
+// put stores data for documentID, evicting the least recently used entry
+// when the cache is full
+func (c *entityCache) put(documentID string, data *cedarauthz.EntityData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[documentID]; ok {
+		element.Value = &cacheEntry{documentID: documentID, data: data, storedAt: c.now()}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[documentID] = c.order.PushFront(&cacheEntry{documentID: documentID, data: data, storedAt: c.now()})
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).documentID)
+	}
+}
+
+// stats returns the hit and miss counters
+func (c *entityCache) stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
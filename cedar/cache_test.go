@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// Batch workers share one cache, so get, put and stats run concurrently.
+// Run with -race; the small bound and short TTL make evictions and
+// expirations race with lookups.
+func TestEntityCacheConcurrentUse(t *testing.T) {
+	const workers, lookups, documents, maxEntries = 8, 500, 16, 4
+	cache := newEntityCache(time.Millisecond, maxEntries)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lookups; i++ {
+				documentID := fmt.Sprintf("doc%d", (w+i)%documents)
+				data, ok := cache.get(documentID)
+				if !ok {
+					cache.put(documentID, &cedarauthz.EntityData{DocumentID: documentID})
+				} else if data.DocumentID != documentID {
+					t.Errorf("get(%s) returned the data of %s", documentID, data.DocumentID)
+				}
+				cache.stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	hits, misses := cache.stats()
+	if hits+misses != workers*lookups {
+		t.Errorf("got %d hits and %d misses, want %d lookups", hits, misses, workers*lookups)
+	}
+	if len(cache.entries) > maxEntries || cache.order.Len() != len(cache.entries) {
+		t.Errorf("got %d entries and %d in LRU order, want at most %d of each",
+			len(cache.entries), cache.order.Len(), maxEntries)
+	}
+}
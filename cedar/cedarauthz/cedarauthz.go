@@ -0,0 +1,397 @@
+// Package cedarauthz builds the Cedar entities of the document management
+// model and authorizes requests against them. It has no database access:
+// callers load EntityData however they like, e.g. with the entity query of
+// cedar-check.
+package cedarauthz
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+// EntityData holds all the data needed to build Cedar entities
+type EntityData struct {
+	UserOrganization     string
+	UserIsAdmin          bool     // admin of UserOrganization
+	UserGroups           []string // groups the user is a member of
+	DocumentID           string
+	DocumentOrg          string
+	DocumentPublic       bool // viewable by anyone, including unknown users
+	FolderID             *string
+	DocumentOwner        *string
+	FolderOrg            *string
+	FolderOwner          *string
+	WorkspaceID          *string
+	WorkspaceOrg         *string
+	FolderAncestors      []FolderAncestor    // folders above FolderID, nearest first
+	DocumentPermissions  map[string][]string // permissionType -> userIDs
+	FolderPermissions    map[string][]string // permissionType -> userIDs, including inherited ones
+	WorkspacePermissions map[string][]string // permissionType -> userIDs
+
+	DocumentGroupPermissions map[string][]string // permissionType -> groupIDs
+	FolderGroupPermissions   map[string][]string // permissionType -> groupIDs, including inherited ones
+
+	// DocumentExpirations holds the time-bounded grants of
+	// DocumentPermissions and when they expire
+	DocumentExpirations map[DocumentGrant]time.Time
+}
+
+// DocumentGrant is a user's permission on the document
+type DocumentGrant struct {
+	PermissionType string
+	UserID         string
+}
+
+// FolderAncestor is a folder that (transitively) contains the document's folder
+type FolderAncestor struct {
+	ID           string
+	Organization string
+}
+
+// BuildEntities builds the Cedar entities for data and returns them with the
+// principal and resource UIDs
+func (n Namespace) BuildEntities(data *EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID) {
+	entities := cedar.EntityMap{}
+
+	// The user, document, folders and workspace usually share one
+	// organization. Each reference goes through organization, and the
+	// entities are built once at the end.
+	organizations := make(map[cedar.EntityUID]bool)
+	organization := func(orgID string) cedar.EntityUID {
+		orgUID := cedar.NewEntityUID(n.Organization(), cedar.String(orgID))
+		organizations[orgUID] = true
+		return orgUID
+	}
+
+	// User entity; is_admin is always set, since org admins need no
+	// permission rows to be allowed
+	userAttrs := cedar.RecordMap{"is_admin": cedar.Boolean(data.UserIsAdmin)}
+	if data.UserOrganization != "" {
+		userAttrs["organization"] = organization(data.UserOrganization)
+	}
+	// The user's groups are its Cedar parents, so "principal in Group::..."
+	// and "principal in resource.editor_groups" hold for members
+	var groupUIDs []cedar.EntityUID
+	for _, groupID := range data.UserGroups {
+		groupUID := cedar.NewEntityUID(n.Group(), cedar.String(groupID))
+		groupUIDs = append(groupUIDs, groupUID)
+		entities[groupUID] = cedar.Entity{
+			UID:        groupUID,
+			Attributes: cedar.NewRecord(cedar.RecordMap{"name": cedar.String(groupID)}),
+		}
+	}
+	userUID := cedar.NewEntityUID(n.User(), cedar.String(userID))
+	entities[userUID] = cedar.Entity{
+		UID:        userUID,
+		Parents:    cedar.NewEntityUIDSet(groupUIDs...),
+		Attributes: cedar.NewRecord(userAttrs),
+	}
+
+	// Document entity
+	docAttrs := cedar.RecordMap{"name": cedar.String(data.DocumentID), "public": cedar.Boolean(data.DocumentPublic)}
+	if data.DocumentOrg != "" {
+		docAttrs["organization"] = organization(data.DocumentOrg)
+	}
+	if data.DocumentOwner != nil {
+		ownerUID := cedar.NewEntityUID(n.User(), cedar.String(*data.DocumentOwner))
+		docAttrs["owner"] = cedar.EntityUID(ownerUID)
+	}
+	if data.FolderID != nil {
+		folderUID := cedar.NewEntityUID(n.Folder(), cedar.String(*data.FolderID))
+		docAttrs["parent_folder"] = cedar.EntityUID(folderUID)
+	}
+
+	// Add document permissions (editors, viewers)
+	if len(data.DocumentPermissions["editor"]) > 0 {
+		var editorValues []cedar.Value
+		for _, editorID := range data.DocumentPermissions["editor"] {
+			editorUID := cedar.NewEntityUID(n.User(), cedar.String(editorID))
+			editorValues = append(editorValues, cedar.EntityUID(editorUID))
+		}
+		docAttrs["editors"] = cedar.NewSet(editorValues...)
+	} else {
+		docAttrs["editors"] = cedar.NewSet()
+	}
+	if len(data.DocumentPermissions["viewer"]) > 0 {
+		var viewerValues []cedar.Value
+		for _, viewerID := range data.DocumentPermissions["viewer"] {
+			viewerUID := cedar.NewEntityUID(n.User(), cedar.String(viewerID))
+			viewerValues = append(viewerValues, cedar.EntityUID(viewerUID))
+		}
+		docAttrs["viewers"] = cedar.NewSet(viewerValues...)
+	} else {
+		docAttrs["viewers"] = cedar.NewSet()
+	}
+	docAttrs["editor_groups"] = n.groupSet(data.DocumentGroupPermissions["editor"])
+	docAttrs["viewer_groups"] = n.groupSet(data.DocumentGroupPermissions["viewer"])
+
+	// Create folder entity if exists
+	if data.FolderID != nil {
+		// Add folder entity
+		folderAttrs := cedar.RecordMap{"name": cedar.String(*data.FolderID)}
+		if data.FolderOrg != nil {
+			folderAttrs["organization"] = organization(*data.FolderOrg)
+		}
+		if data.FolderOwner != nil {
+			ownerUID := cedar.NewEntityUID(n.User(), cedar.String(*data.FolderOwner))
+			folderAttrs["owner"] = cedar.EntityUID(ownerUID)
+		}
+
+		// Add folder permissions (editors, viewers)
+		if len(data.FolderPermissions["editor"]) > 0 {
+			var editorValues []cedar.Value
+			for _, editorID := range data.FolderPermissions["editor"] {
+				editorUID := cedar.NewEntityUID(n.User(), cedar.String(editorID))
+				editorValues = append(editorValues, cedar.EntityUID(editorUID))
+			}
+			folderAttrs["editors"] = cedar.NewSet(editorValues...)
+		} else {
+			folderAttrs["editors"] = cedar.NewSet()
+		}
+
+		if len(data.FolderPermissions["viewer"]) > 0 {
+			var viewerValues []cedar.Value
+			for _, viewerID := range data.FolderPermissions["viewer"] {
+				viewerUID := cedar.NewEntityUID(n.User(), cedar.String(viewerID))
+				viewerValues = append(viewerValues, cedar.EntityUID(viewerUID))
+			}
+			folderAttrs["viewers"] = cedar.NewSet(viewerValues...)
+		} else {
+			folderAttrs["viewers"] = cedar.NewSet()
+		}
+		folderAttrs["editor_groups"] = n.groupSet(data.FolderGroupPermissions["editor"])
+		folderAttrs["viewer_groups"] = n.groupSet(data.FolderGroupPermissions["viewer"])
+
+		// Chain the ancestors through parent_folder, farthest first so each
+		// one's parent is known. Their permissions are already folded into
+		// this folder's sets by the query, so they only carry the attributes
+		// needed to follow the chain.
+		var parentUID *cedar.EntityUID
+		for i := len(data.FolderAncestors) - 1; i >= 0; i-- {
+			ancestor := data.FolderAncestors[i]
+			ancestorUID := cedar.NewEntityUID(n.Folder(), cedar.String(ancestor.ID))
+			ancestorAttrs := cedar.RecordMap{
+				"name":         cedar.String(ancestor.ID),
+				"organization": organization(ancestor.Organization),
+			}
+			if parentUID != nil {
+				ancestorAttrs["parent_folder"] = cedar.EntityUID(*parentUID)
+			}
+			entities[ancestorUID] = cedar.Entity{
+				UID:        ancestorUID,
+				Attributes: cedar.NewRecord(ancestorAttrs),
+			}
+			parentUID = &ancestorUID
+		}
+		if parentUID != nil {
+			folderAttrs["parent_folder"] = cedar.EntityUID(*parentUID)
+		}
+
+		// Add the workspace the folder belongs to, whose admins can edit
+		// everything inside it
+		if data.WorkspaceID != nil {
+			workspaceUID := cedar.NewEntityUID(n.Workspace(), cedar.String(*data.WorkspaceID))
+			folderAttrs["workspace"] = cedar.EntityUID(workspaceUID)
+
+			workspaceAttrs := cedar.RecordMap{"name": cedar.String(*data.WorkspaceID)}
+			if data.WorkspaceOrg != nil {
+				workspaceAttrs["organization"] = organization(*data.WorkspaceOrg)
+			}
+			var adminValues []cedar.Value
+			for _, adminID := range data.WorkspacePermissions["admin"] {
+				adminUID := cedar.NewEntityUID(n.User(), cedar.String(adminID))
+				adminValues = append(adminValues, cedar.EntityUID(adminUID))
+			}
+			workspaceAttrs["admins"] = cedar.NewSet(adminValues...)
+
+			entities[workspaceUID] = cedar.Entity{
+				UID:        workspaceUID,
+				Attributes: cedar.NewRecord(workspaceAttrs),
+			}
+		}
+
+		folderUID := cedar.NewEntityUID(n.Folder(), cedar.String(*data.FolderID))
+		entities[folderUID] = cedar.Entity{
+			UID:        folderUID,
+			Attributes: cedar.NewRecord(folderAttrs),
+		}
+	}
+	docUID := cedar.NewEntityUID(n.Document(), cedar.String(documentID))
+	entities[docUID] = cedar.Entity{
+		UID:        docUID,
+		Attributes: cedar.NewRecord(docAttrs),
+	}
+
+	for orgUID := range organizations {
+		entities[orgUID] = cedar.Entity{
+			UID:        orgUID,
+			Attributes: cedar.NewRecord(cedar.RecordMap{"name": orgUID.ID}),
+		}
+	}
+	n.addReferencedStubs(entities)
+
+	return entities, userUID, docUID
+}
+
+// addReferencedStubs adds an entity for every user and group that entities
+// refer to without building it, e.g. owners, editors and editor_groups other
+// than the principal's. Policies only compare those with the principal, so
+// users get no attributes and groups only their name.
+func (n Namespace) addReferencedStubs(entities cedar.EntityMap) {
+	var stubs []cedar.EntityUID
+	for _, entity := range entities {
+		refs := slices.Collect(entity.Parents.All())
+		for value := range entity.Attributes.Values() {
+			refs = entityReferences(refs, value)
+		}
+		for _, ref := range refs {
+			if _, ok := entities[ref]; !ok && (ref.Type == n.User() || ref.Type == n.Group()) {
+				stubs = append(stubs, ref)
+			}
+		}
+	}
+	for _, uid := range stubs {
+		attrs := cedar.RecordMap{}
+		if uid.Type == n.Group() {
+			attrs["name"] = uid.ID
+		}
+		entities[uid] = cedar.Entity{UID: uid, Attributes: cedar.NewRecord(attrs)}
+	}
+}
+
+// ErrDanglingReference is returned by CheckReferences when an attribute or
+// parent refers to an entity that wasn't built
+var ErrDanglingReference = errors.New("entity refers to an entity that wasn't built")
+
+// CheckReferences returns ErrDanglingReference unless every entity referenced
+// by an attribute or parent of entities is in entities, whatever its type.
+// Policies read the attributes of organizations, workspaces and folders, e.g.
+// resource.parent_folder.editors, so a missing one silently denies, and a
+// missing user or group makes the entities invalid for the schema.
+func (n Namespace) CheckReferences(entities cedar.EntityMap) error {
+	var missing []string
+	check := func(from cedar.EntityUID, uid cedar.EntityUID) {
+		if _, ok := entities[uid]; !ok {
+			missing = append(missing, fmt.Sprintf("%s -> %s", from, uid))
+		}
+	}
+	for uid, entity := range entities {
+		for parent := range entity.Parents.All() {
+			check(uid, parent)
+		}
+		for value := range entity.Attributes.Values() {
+			for _, ref := range entityReferences(nil, value) {
+				check(uid, ref)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("%w: %s", ErrDanglingReference, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// entityReferences appends the entity UIDs in value, including those in sets
+// and records, to refs
+func entityReferences(refs []cedar.EntityUID, value cedar.Value) []cedar.EntityUID {
+	switch v := value.(type) {
+	case cedar.EntityUID:
+		refs = append(refs, v)
+	case cedar.Set:
+		for member := range v.All() {
+			refs = entityReferences(refs, member)
+		}
+	case cedar.Record:
+		for field := range v.Values() {
+			refs = entityReferences(refs, field)
+		}
+	}
+	return refs
+}
+
+// groupSet returns the set of Group UIDs for groupIDs
+func (n Namespace) groupSet(groupIDs []string) cedar.Set {
+	var values []cedar.Value
+	for _, groupID := range groupIDs {
+		values = append(values, cedar.NewEntityUID(n.Group(), cedar.String(groupID)))
+	}
+	return cedar.NewSet(values...)
+}
+
+// Authorize authorizes principal to perform action on resource against
+// entities and the request context, returning Cedar's diagnostic so callers
+// can explain the decision. Evaluation errors are returned as an error with
+// a deny.
+func Authorize(ps *cedar.PolicySet, entities cedar.EntityMap, principal, action, resource cedar.EntityUID, ctx cedar.RecordMap) (bool, cedar.Diagnostic, error) {
+	request := cedar.Request{
+		Principal: principal,
+		Action:    action,
+		Resource:  resource,
+		Context:   cedar.NewRecord(ctx),
+	}
+	decision, diagnostic := cedar.Authorize(ps, entities, request)
+	if len(diagnostic.Errors) > 0 {
+		return false, diagnostic, fmt.Errorf("authorization errors: %v", diagnostic.Errors)
+	}
+	return decision == cedar.Allow, diagnostic, nil
+}
+
+// BuildHierarchyEntities builds the same entities as BuildEntities and also
+// records the containment hierarchy in their parents: the document is a
+// child of its folder and organization, and every folder of its parent
+// folder and organization. Policies can then use `resource in
+// DocumentManagement::Folder::"folder3"` or `resource in
+// principal.organization` instead of following parent_folder and
+// organization attributes. The attributes are kept, so attribute-based
+// policies decide the same either way.
+func (n Namespace) BuildHierarchyEntities(data *EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID) {
+	entities, userUID, docUID := n.BuildEntities(data, userID, documentID)
+
+	var docParents []cedar.EntityUID
+	if data.DocumentOrg != "" {
+		docParents = append(docParents, cedar.NewEntityUID(n.Organization(), cedar.String(data.DocumentOrg)))
+	}
+	if data.FolderID != nil {
+		folderUID := cedar.NewEntityUID(n.Folder(), cedar.String(*data.FolderID))
+		docParents = append(docParents, folderUID)
+
+		var folderParents []cedar.EntityUID
+		if data.FolderOrg != nil {
+			folderParents = append(folderParents, cedar.NewEntityUID(n.Organization(), cedar.String(*data.FolderOrg)))
+		}
+		if len(data.FolderAncestors) > 0 {
+			folderParents = append(folderParents, cedar.NewEntityUID(n.Folder(), cedar.String(data.FolderAncestors[0].ID)))
+		}
+		setParents(entities, folderUID, folderParents)
+
+		// Ancestors are nearest first, so each one's parent folder is the next
+		for i, ancestor := range data.FolderAncestors {
+			ancestorParents := []cedar.EntityUID{
+				cedar.NewEntityUID(n.Organization(), cedar.String(ancestor.Organization)),
+			}
+			if i+1 < len(data.FolderAncestors) {
+				ancestorParents = append(ancestorParents, cedar.NewEntityUID(n.Folder(), cedar.String(data.FolderAncestors[i+1].ID)))
+			}
+			setParents(entities, cedar.NewEntityUID(n.Folder(), cedar.String(ancestor.ID)), ancestorParents)
+		}
+	}
+	setParents(entities, docUID, docParents)
+
+	return entities, userUID, docUID
+}
+
+// setParents replaces the parents of the entity uid, if it was built
+func setParents(entities cedar.EntityMap, uid cedar.EntityUID, parents []cedar.EntityUID) {
+	entity, ok := entities[uid]
+	if !ok {
+		return
+	}
+	entity.Parents = cedar.NewEntityUIDSet(parents...)
+	entities[uid] = entity
+}
@@ -0,0 +1,265 @@
+package cedarauthz
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+func TestBuildEntities(t *testing.T) {
+	n := DefaultNamespace
+	user := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.User(), cedar.String(id)) }
+	group := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Group(), cedar.String(id)) }
+	org := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Organization(), cedar.String(id)) }
+	workspace := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Workspace(), cedar.String(id)) }
+	folder := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Folder(), cedar.String(id)) }
+	document := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Document(), cedar.String(id)) }
+	ptr := func(s string) *string { return &s }
+	entity := func(uid cedar.EntityUID, attrs cedar.RecordMap, parents ...cedar.EntityUID) cedar.Entity {
+		return cedar.Entity{UID: uid, Parents: cedar.NewEntityUIDSet(parents...), Attributes: cedar.NewRecord(attrs)}
+	}
+	named := func(uid cedar.EntityUID) cedar.Entity {
+		return entity(uid, cedar.RecordMap{"name": uid.ID})
+	}
+	// stub is a user referenced without being the principal
+	stub := func(uid cedar.EntityUID) cedar.Entity {
+		return entity(uid, cedar.RecordMap{})
+	}
+	// grants returns the editors, viewers and group sets of a document or
+	// folder
+	grants := func(attrs cedar.RecordMap, editors, viewers []cedar.Value, editorGroups, viewerGroups []cedar.Value) cedar.RecordMap {
+		attrs["editors"] = cedar.NewSet(editors...)
+		attrs["viewers"] = cedar.NewSet(viewers...)
+		attrs["editor_groups"] = cedar.NewSet(editorGroups...)
+		attrs["viewer_groups"] = cedar.NewSet(viewerGroups...)
+		return attrs
+	}
+
+	tests := []struct {
+		name   string
+		data   *EntityData
+		userID string
+		want   []cedar.Entity
+	}{
+		{
+			name: "user with no organization",
+			data: &EntityData{
+				DocumentID: "doc7", DocumentOrg: "org2", DocumentPublic: true, DocumentOwner: ptr("david"),
+			},
+			userID: "mallory",
+			want: []cedar.Entity{
+				entity(user("mallory"), cedar.RecordMap{"is_admin": cedar.False}),
+				entity(document("doc7"), grants(cedar.RecordMap{
+					"name": cedar.String("doc7"), "public": cedar.True,
+					"organization": org("org2"), "owner": user("david"),
+				}, nil, nil, nil, nil)),
+				named(org("org2")),
+				stub(user("david")),
+			},
+		},
+		{
+			name: "nil FolderID",
+			data: &EntityData{
+				UserOrganization: "org1", DocumentID: "doc3", DocumentOrg: "org2", DocumentOwner: ptr("david"),
+				DocumentPermissions: map[string][]string{"viewer": {"charlie"}},
+			},
+			userID: "charlie",
+			want: []cedar.Entity{
+				entity(user("charlie"), cedar.RecordMap{"is_admin": cedar.False, "organization": org("org1")}),
+				entity(document("doc3"), grants(cedar.RecordMap{
+					"name": cedar.String("doc3"), "public": cedar.False,
+					"organization": org("org2"), "owner": user("david"),
+				}, nil, []cedar.Value{user("charlie")}, nil, nil)),
+				named(org("org1")),
+				named(org("org2")),
+				stub(user("david")),
+			},
+		},
+		{
+			name: "missing owner",
+			data: &EntityData{
+				UserOrganization: "org1", DocumentID: "doc2", DocumentOrg: "org1",
+				FolderID: ptr("folder1"), FolderOrg: ptr("org1"),
+				FolderPermissions: map[string][]string{"editor": {"bob"}},
+			},
+			userID: "bob",
+			want: []cedar.Entity{
+				entity(user("bob"), cedar.RecordMap{"is_admin": cedar.False, "organization": org("org1")}),
+				entity(document("doc2"), grants(cedar.RecordMap{
+					"name": cedar.String("doc2"), "public": cedar.False,
+					"organization": org("org1"), "parent_folder": folder("folder1"),
+				}, nil, nil, nil, nil)),
+				entity(folder("folder1"), grants(cedar.RecordMap{
+					"name": cedar.String("folder1"), "organization": org("org1"),
+				}, []cedar.Value{user("bob")}, nil, nil, nil)),
+				named(org("org1")),
+			},
+		},
+		{
+			name: "empty permission maps",
+			data: &EntityData{
+				UserOrganization: "org1", UserIsAdmin: true, DocumentID: "doc1", DocumentOrg: "org1",
+				FolderID: ptr("folder1"), FolderOrg: ptr("org1"),
+				WorkspaceID: ptr("ws1"), WorkspaceOrg: ptr("org1"),
+			},
+			userID: "henry",
+			want: []cedar.Entity{
+				entity(user("henry"), cedar.RecordMap{"is_admin": cedar.True, "organization": org("org1")}),
+				entity(document("doc1"), grants(cedar.RecordMap{
+					"name": cedar.String("doc1"), "public": cedar.False,
+					"organization": org("org1"), "parent_folder": folder("folder1"),
+				}, nil, nil, nil, nil)),
+				entity(folder("folder1"), grants(cedar.RecordMap{
+					"name": cedar.String("folder1"), "organization": org("org1"), "workspace": workspace("ws1"),
+				}, nil, nil, nil, nil)),
+				entity(workspace("ws1"), cedar.RecordMap{
+					"name": cedar.String("ws1"), "organization": org("org1"), "admins": cedar.NewSet(),
+				}),
+				named(org("org1")),
+			},
+		},
+		{
+			name: "groups and nested folders",
+			data: &EntityData{
+				UserOrganization: "org2", UserGroups: []string{"apollo"},
+				DocumentID: "doc6", DocumentOrg: "org1", DocumentOwner: ptr("alice"),
+				FolderID: ptr("folder5"), FolderOrg: ptr("org1"), FolderOwner: ptr("alice"),
+				FolderAncestors:        []FolderAncestor{{ID: "folder4", Organization: "org1"}, {ID: "folder3", Organization: "org1"}},
+				DocumentPermissions:    map[string][]string{"editor": {"bob"}},
+				FolderPermissions:      map[string][]string{"viewer": {"eve"}},
+				FolderGroupPermissions: map[string][]string{"editor": {"apollo"}},
+			},
+			userID: "frank",
+			want: []cedar.Entity{
+				entity(user("frank"), cedar.RecordMap{"is_admin": cedar.False, "organization": org("org2")}, group("apollo")),
+				entity(group("apollo"), cedar.RecordMap{"name": cedar.String("apollo")}),
+				entity(document("doc6"), grants(cedar.RecordMap{
+					"name": cedar.String("doc6"), "public": cedar.False,
+					"organization": org("org1"), "owner": user("alice"), "parent_folder": folder("folder5"),
+				}, []cedar.Value{user("bob")}, nil, nil, nil)),
+				entity(folder("folder5"), grants(cedar.RecordMap{
+					"name": cedar.String("folder5"), "organization": org("org1"), "owner": user("alice"),
+					"parent_folder": folder("folder4"),
+				}, nil, []cedar.Value{user("eve")}, []cedar.Value{group("apollo")}, nil)),
+				entity(folder("folder4"), cedar.RecordMap{
+					"name": cedar.String("folder4"), "organization": org("org1"), "parent_folder": folder("folder3"),
+				}),
+				entity(folder("folder3"), cedar.RecordMap{
+					"name": cedar.String("folder3"), "organization": org("org1"),
+				}),
+				named(org("org1")),
+				named(org("org2")),
+				stub(user("alice")),
+				stub(user("bob")),
+				stub(user("eve")),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entities, principal, resource := n.BuildEntities(tt.data, tt.userID, tt.data.DocumentID)
+			if principal != user(tt.userID) || resource != document(tt.data.DocumentID) {
+				t.Errorf("got principal %s and resource %s", principal, resource)
+			}
+			assertEntities(t, entities, tt.want)
+			if err := n.CheckReferences(entities); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// BuildHierarchyEntities adds the containment parents to the entities of
+// BuildEntities
+func TestBuildHierarchyEntitiesParents(t *testing.T) {
+	n := DefaultNamespace
+	folderID, folderOrg := "folder5", "org1"
+	data := &EntityData{
+		UserOrganization: "org1", DocumentID: "doc6", DocumentOrg: "org1",
+		FolderID: &folderID, FolderOrg: &folderOrg,
+		FolderAncestors: []FolderAncestor{{ID: "folder4", Organization: "org1"}, {ID: "folder3", Organization: "org1"}},
+	}
+	entities, _, _ := n.BuildHierarchyEntities(data, "eve", "doc6")
+
+	org1 := cedar.NewEntityUID(n.Organization(), "org1")
+	folder := func(id string) cedar.EntityUID { return cedar.NewEntityUID(n.Folder(), cedar.String(id)) }
+	want := map[cedar.EntityUID][]cedar.EntityUID{
+		cedar.NewEntityUID(n.Document(), "doc6"): {org1, folder("folder5")},
+		folder("folder5"):                        {org1, folder("folder4")},
+		folder("folder4"):                        {org1, folder("folder3")},
+		folder("folder3"):                        {org1},
+		cedar.NewEntityUID(n.User(), "eve"):      nil,
+		org1:                                     nil,
+	}
+	for uid, parents := range want {
+		if got := entities[uid].Parents; !got.Equal(cedar.NewEntityUIDSet(parents...)) {
+			t.Errorf("parents of %s: got %v, want %v", uid, got, parents)
+		}
+	}
+}
+
+// assertEntities fails unless entities holds exactly want
+func assertEntities(t *testing.T, entities cedar.EntityMap, want []cedar.Entity) {
+	t.Helper()
+	if len(entities) != len(want) {
+		t.Errorf("got %d entities, want %d", len(entities), len(want))
+	}
+	for _, w := range want {
+		got, ok := entities[w.UID]
+		if !ok {
+			t.Errorf("missing %s", w.UID)
+			continue
+		}
+		if !got.Equal(w) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(w)
+			t.Errorf("%s:\ngot  %s\nwant %s", w.UID, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	n := DefaultNamespace
+	alice := cedar.NewEntityUID(n.User(), "alice")
+	apollo := cedar.NewEntityUID(n.Group(), "apollo")
+	doc1 := cedar.NewEntityUID(n.Document(), "doc1")
+	tests := []struct {
+		name     string
+		entities cedar.EntityMap
+		want     string // the dangling reference, or "" for none
+	}{
+		{
+			name: "user attribute",
+			entities: cedar.EntityMap{doc1: {UID: doc1, Attributes: cedar.NewRecord(cedar.RecordMap{
+				"editors": cedar.NewSet(alice),
+			})}},
+			want: `DocumentManagement::Document::"doc1" -> DocumentManagement::User::"alice"`,
+		},
+		{
+			name:     "group parent",
+			entities: cedar.EntityMap{alice: {UID: alice, Parents: cedar.NewEntityUIDSet(apollo)}},
+			want:     `DocumentManagement::User::"alice" -> DocumentManagement::Group::"apollo"`,
+		},
+		{
+			name: "all built",
+			entities: cedar.EntityMap{
+				alice:  {UID: alice, Parents: cedar.NewEntityUIDSet(apollo)},
+				apollo: {UID: apollo},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := n.CheckReferences(tt.entities)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case tt.want != "" && (!errors.Is(err, ErrDanglingReference) || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got error %v, want ErrDanglingReference for %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cedarauthz
+
+import "github.com/cedar-policy/cedar-go"
+
+// Namespace is the Cedar namespace the entity types of the document
+// management model are declared in, e.g. DocumentManagement for
+// DocumentManagement::User. An empty Namespace builds unqualified types.
+type Namespace string
+
+// DefaultNamespace is the namespace of schema.cedarschema
+const DefaultNamespace Namespace = "DocumentManagement"
+
+// entityType qualifies name with the namespace
+func (n Namespace) entityType(name string) cedar.EntityType {
+	if n == "" {
+		return cedar.EntityType(name)
+	}
+	return cedar.EntityType(string(n) + "::" + name)
+}
+
+func (n Namespace) User() cedar.EntityType         { return n.entityType("User") }
+func (n Namespace) Group() cedar.EntityType        { return n.entityType("Group") }
+func (n Namespace) Organization() cedar.EntityType { return n.entityType("Organization") }
+func (n Namespace) Workspace() cedar.EntityType    { return n.entityType("Workspace") }
+func (n Namespace) Folder() cedar.EntityType       { return n.entityType("Folder") }
+func (n Namespace) Document() cedar.EntityType     { return n.entityType("Document") }
+func (n Namespace) Action() cedar.EntityType       { return n.entityType("Action") }
+
+// BuildEntities is DefaultNamespace.BuildEntities
+func BuildEntities(data *EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID) {
+	return DefaultNamespace.BuildEntities(data, userID, documentID)
+}
+
+// BuildHierarchyEntities is DefaultNamespace.BuildHierarchyEntities
+func BuildHierarchyEntities(data *EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID) {
+	return DefaultNamespace.BuildHierarchyEntities(data, userID, documentID)
+}
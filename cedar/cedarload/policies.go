@@ -0,0 +1,156 @@
+// Package cedarload loads Cedar policies and schemas from any fs.FS, so they
+// can come from the working directory as well as from files embedded in a
+// binary. Parse errors are located in the source, with a hint when the
+// offending line uses a construct the compiled cedar-go can't parse.
+package cedarload
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+// LoadPolicySet reads and parses the named Cedar policy file from fsys, which
+// may be the working directory, an embed.FS or any other fs.FS
+func LoadPolicySet(fsys fs.FS, name string) (*cedar.PolicySet, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policies: %w", err)
+	}
+	defer f.Close()
+	return ReadPolicySet(name, f)
+}
+
+// LoadPolicies loads name from fsys as a single policy file or, when it is a
+// directory, merges every *.cedar file in it in lexical order. Policy IDs
+// from a directory are prefixed with their file name (document.cedar/policy0)
+// so diagnostics stay traceable.
+func LoadPolicies(fsys fs.FS, name string) (*cedar.PolicySet, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policies: %w", err)
+	}
+	if !info.IsDir() {
+		return LoadPolicySet(fsys, name)
+	}
+
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+	merged := cedar.NewPolicySet()
+	files := 0
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".cedar" {
+			continue
+		}
+		files++
+		policySet, err := LoadPolicySet(fsys, path.Join(name, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for id, policy := range policySet.All() {
+			merged.Add(cedar.PolicyID(entry.Name()+"/"+string(id)), policy)
+		}
+	}
+	if files == 0 {
+		return nil, fmt.Errorf("no .cedar policy files in %s", name)
+	}
+	return merged, nil
+}
+
+// ReadPolicySet parses Cedar policies from r; name is used in error positions
+func ReadPolicySet(name string, r io.Reader) (*cedar.PolicySet, error) {
+	policies, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policies: %w", err)
+	}
+	policySet, err := cedar.NewPolicySetFromBytes(name, policies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %w", NewPolicyParseError(name, policies, err))
+	}
+	return policySet, nil
+}
+
+// PolicyParseError locates a Cedar parse error in the policy source. cedar-go
+// only reports "<input>:line:column" in its error text, so the file name,
+// offending line and version hint are added here.
+type PolicyParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Snippet string // the offending source line
+	Hint    string // set when the line uses a construct the compiled cedar-go lacks
+	Err     error
+}
+
+// parseErrorPosition matches both parser ("parse error at <input>:2:25 "1":
+// invalid primary") and tokenizer ("<input>:1:5: invalid char") positions
+var parseErrorPosition = regexp.MustCompile(`<input>:(\d+):(\d+)(?: ("(?:[^"\\]|\\.)*"))?:? (.*)$`)
+
+// NewPolicyParseError wraps err, an error of parsing src with cedar-go, with
+// its location in src, or returns err unchanged when no position can be
+// found in it
+func NewPolicyParseError(name string, src []byte, err error) error {
+	match := parseErrorPosition.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	parseErr := &PolicyParseError{File: name, Line: line, Column: column, Message: match[4], Err: err}
+	if match[3] != "" {
+		parseErr.Message += " near " + match[3]
+	}
+
+	lines := strings.Split(string(src), "\n")
+	if line >= 1 && line <= len(lines) {
+		parseErr.Snippet = strings.TrimRight(lines[line-1], "\r")
+		for _, finding := range FindGatedConstructs(parseErr.Snippet) {
+			if finding.MinVersion == "" {
+				parseErr.Hint = fmt.Sprintf("%s is not supported by cedar-go", finding.Construct)
+				break
+			}
+			if !compiledCedarGoSupports(finding.MinVersion) {
+				parseErr.Hint = fmt.Sprintf("%s requires cedar-go %s or newer (compiled with %s)",
+					finding.Construct, finding.MinVersion, CompiledCedarGoVersion())
+				break
+			}
+		}
+	}
+	return parseErr
+}
+
+func (e *PolicyParseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	if e.Snippet != "" {
+		fmt.Fprintf(&b, "\n    %s", e.Snippet)
+		if e.Column >= 1 {
+			// Keep tabs so the caret lines up with the snippet
+			prefix := []rune(e.Snippet)[:min(e.Column-1, len([]rune(e.Snippet)))]
+			indent := strings.Map(func(r rune) rune {
+				if r == '\t' {
+					return r
+				}
+				return ' '
+			}, string(prefix))
+			fmt.Fprintf(&b, "\n    %s^", indent)
+		}
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&b, "\n    hint: %s", e.Hint)
+	}
+	return b.String()
+}
+
+func (e *PolicyParseError) Unwrap() error {
+	return e.Err
+}
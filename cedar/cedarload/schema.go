@@ -0,0 +1,185 @@
+package cedarload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go/x/exp/schema"
+)
+
+// Schema is the runtime view of a human-readable Cedar schema such as
+// schema.cedarschema: the namespace, the entity types with their attribute
+// names, and the declared actions
+type Schema struct {
+	Namespace   string
+	EntityTypes map[string][]string        // entity type -> attribute names
+	Actions     map[string]ActionAppliesTo // action name -> applicable types
+
+	// entity type -> attribute -> the entity type it refers to, directly or
+	// as a set element; empty for attributes that aren't entities
+	attributeEntities map[string]map[string]string
+}
+
+// ActionAppliesTo lists the principal and resource types an action applies to
+type ActionAppliesTo struct {
+	PrincipalTypes []string
+	ResourceTypes  []string
+}
+
+// jsonSchemaNamespace mirrors the parts of the Cedar JSON schema format we read
+type jsonSchemaNamespace struct {
+	EntityTypes map[string]struct {
+		Shape struct {
+			Attributes map[string]jsonSchemaType `json:"attributes"`
+		} `json:"shape"`
+	} `json:"entityTypes"`
+	Actions map[string]struct {
+		AppliesTo struct {
+			PrincipalTypes []string `json:"principalTypes"`
+			ResourceTypes  []string `json:"resourceTypes"`
+		} `json:"appliesTo"`
+	} `json:"actions"`
+}
+
+// jsonSchemaType is an attribute type of the Cedar JSON schema format
+type jsonSchemaType struct {
+	Type    string          `json:"type"`
+	Name    string          `json:"name"`
+	Element *jsonSchemaType `json:"element"`
+}
+
+// entityName returns the entity type t refers to, directly or as a set
+// element, or "" when it isn't an entity
+func (t jsonSchemaType) entityName() string {
+	switch t.Type {
+	case "Entity", "EntityOrCommon":
+		return t.Name
+	case "Set":
+		if t.Element != nil {
+			return t.Element.entityName()
+		}
+	}
+	return ""
+}
+
+// LoadSchema reads and parses the named human-readable Cedar schema from fsys,
+// which may be the working directory, an embed.FS or any other fs.FS
+func LoadSchema(fsys fs.FS, name string) (*Schema, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schema: %w", err)
+	}
+	defer f.Close()
+	return ReadSchema(name, f)
+}
+
+// ReadSchema parses a human-readable Cedar schema from r; name is used in
+// error positions
+func ReadSchema(name string, r io.Reader) (*Schema, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return ParseSchema(name, src)
+}
+
+// ParseSchema parses a human-readable Cedar schema declaring a single namespace
+func ParseSchema(filename string, src []byte) (*Schema, error) {
+	var s schema.Schema
+	s.SetFilename(filename)
+	if err := s.UnmarshalCedar(src); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	// The JSON form is easier to walk than the human-readable AST
+	raw, err := s.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert schema: %w", err)
+	}
+	var namespaces map[string]jsonSchemaNamespace
+	if err := json.Unmarshal(raw, &namespaces); err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	if len(namespaces) != 1 {
+		return nil, fmt.Errorf("schema %s must declare exactly one namespace, found %d", filename, len(namespaces))
+	}
+
+	result := &Schema{
+		EntityTypes:       make(map[string][]string),
+		Actions:           make(map[string]ActionAppliesTo),
+		attributeEntities: make(map[string]map[string]string),
+	}
+	for name, ns := range namespaces {
+		result.Namespace = name
+		for entityType, def := range ns.EntityTypes {
+			var attrs []string
+			entities := make(map[string]string, len(def.Shape.Attributes))
+			for attr, attrType := range def.Shape.Attributes {
+				attrs = append(attrs, attr)
+				entities[attr] = strings.TrimPrefix(attrType.entityName(), name+"::")
+			}
+			slices.Sort(attrs)
+			result.EntityTypes[entityType] = attrs
+			result.attributeEntities[entityType] = entities
+		}
+		for action, def := range ns.Actions {
+			result.Actions[action] = ActionAppliesTo{
+				PrincipalTypes: result.unqualify(def.AppliesTo.PrincipalTypes),
+				ResourceTypes:  result.unqualify(def.AppliesTo.ResourceTypes),
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// unqualify strips the schema namespace from type names, since appliesTo may
+// reference types either way
+func (s *Schema) unqualify(types []string) []string {
+	result := make([]string, 0, len(types))
+	for _, t := range types {
+		result = append(result, s.UnqualifyType(t))
+	}
+	return result
+}
+
+// ActionNames returns the declared action names in sorted order
+func (s *Schema) ActionNames() []string {
+	names := make([]string, 0, len(s.Actions))
+	for name := range s.Actions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ValidateAction checks that action is declared in the schema and applies to
+// resourceType, so invalid requests are rejected before querying the database
+func (s *Schema) ValidateAction(action, resourceType string) error {
+	appliesTo, ok := s.Actions[action]
+	if !ok {
+		return fmt.Errorf("unknown action %q (valid actions: %s)", action, strings.Join(s.ActionNames(), ", "))
+	}
+	if !slices.Contains(appliesTo.ResourceTypes, resourceType) {
+		return fmt.Errorf("action %q does not apply to %s resources (applies to: %s)",
+			action, resourceType, strings.Join(appliesTo.ResourceTypes, ", "))
+	}
+	return nil
+}
+
+// UnqualifyType strips the schema namespace from a single type name
+func (s *Schema) UnqualifyType(t string) string {
+	return strings.TrimPrefix(t, s.Namespace+"::")
+}
+
+// AttributeEntity returns the entity type that attr of entityType refers to,
+// directly or as a set element, or "" when it isn't an entity. ok is false
+// when entityType doesn't declare attr.
+func (s *Schema) AttributeEntity(entityType, attr string) (ref string, ok bool) {
+	ref, ok = s.attributeEntities[entityType][attr]
+	return ref, ok
+}
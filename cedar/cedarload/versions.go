@@ -0,0 +1,118 @@
+package cedarload
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const cedarGoModule = "github.com/cedar-policy/cedar-go"
+
+// GatedConstruct is Cedar syntax that only parses from a given cedar-go release
+type GatedConstruct struct {
+	Construct  string
+	MinVersion string // empty when no cedar-go release supports it yet
+	Pattern    *regexp.Regexp
+}
+
+// gatedConstructs lists the version-gated constructs, taken from the cedar-go
+// change log
+var gatedConstructs = []GatedConstruct{
+	{Construct: "datetime()", MinVersion: "v0.3.2", Pattern: regexp.MustCompile(`\bdatetime\s*\(`)},
+	{Construct: "duration()", MinVersion: "v0.3.2", Pattern: regexp.MustCompile(`\bduration\s*\(`)},
+	{Construct: ".getTag()", MinVersion: "v1.1.0", Pattern: regexp.MustCompile(`\.getTag\s*\(`)},
+	{Construct: ".hasTag()", MinVersion: "v1.1.0", Pattern: regexp.MustCompile(`\.hasTag\s*\(`)},
+	{Construct: ".isEmpty()", MinVersion: "v1.2.0", Pattern: regexp.MustCompile(`\.isEmpty\s*\(`)},
+	{Construct: "template slot (?principal, ?resource)", Pattern: regexp.MustCompile(`\?(principal|resource)\b`)},
+}
+
+// GatedFinding is a gated construct found at a column of a source line
+type GatedFinding struct {
+	GatedConstruct
+	Column int
+}
+
+// FindGatedConstructs returns the gated constructs used in line, ignoring
+// trailing comments
+func FindGatedConstructs(line string) []GatedFinding {
+	code := stripComment(line)
+	var findings []GatedFinding
+	for _, construct := range gatedConstructs {
+		if loc := construct.Pattern.FindStringIndex(code); loc != nil {
+			findings = append(findings, GatedFinding{GatedConstruct: construct, Column: loc[0] + 1})
+		}
+	}
+	return findings
+}
+
+// stripComment removes a // comment that is not inside a string literal
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && inString:
+			i++
+		case line[i] == '"':
+			inString = !inString
+		case !inString && strings.HasPrefix(line[i:], "//"):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// CompiledCedarGoVersion returns the cedar-go version this binary was built
+// with, or "unknown" when build info is unavailable
+func CompiledCedarGoVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == cedarGoModule {
+				if dep.Replace != nil {
+					return dep.Replace.Version
+				}
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
+
+// compiledCedarGoSupports reports whether the compiled cedar-go is at least
+// minVersion. An unknown compiled version is assumed to be new enough.
+func compiledCedarGoSupports(minVersion string) bool {
+	compiled, ok := ParseVersion(CompiledCedarGoVersion())
+	if !ok {
+		return true
+	}
+	required, _ := ParseVersion(minVersion)
+	return CompareVersions(compiled, required) >= 0
+}
+
+// ParseVersion parses "vMAJOR.MINOR.PATCH", ignoring any pre-release suffix
+func ParseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	core, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// CompareVersions orders two versions of ParseVersion like strings.Compare
+func CompareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
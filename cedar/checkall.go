@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"checktable"
+
+	"simple-cedar-check/cedarload"
+)
+
+// actionDecision is the outcome of one action of check-all
+type actionDecision struct {
+	Action     cedar.EntityUID
+	Verb       string // short name, e.g. "view", or the Cedar action name
+	Allowed    bool
+	Diagnostic cedar.Diagnostic
+	Latency    time.Duration // authorization only; the entities are built once
+}
+
+// documentActionNames returns the actions declared by schema that apply to
+// documents, in sorted order
+func documentActionNames(schema *cedarload.Schema) []string {
+	var names []string
+	for _, name := range schema.ActionNames() {
+		if slices.Contains(schema.Actions[name].ResourceTypes, "Document") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseDocumentAction resolves an --action value, either a short name such as
+// "edit" or an action name such as "EditDocument", against the actions
+// declared by schema and returns the action with its short name
+func parseDocumentAction(schema *cedarload.Schema, name string) (string, string, error) {
+	for _, action := range schema.ActionNames() {
+		if !strings.EqualFold(name, action) && !strings.EqualFold(name, actionVerb(action)) {
+			continue
+		}
+		if err := schema.ValidateAction(action, "Document"); err != nil {
+			return "", "", err
+		}
+		return action, actionVerb(action), nil
+	}
+	var verbs []string
+	for _, action := range documentActionNames(schema) {
+		verbs = append(verbs, actionVerb(action))
+	}
+	return "", "", fmt.Errorf("unknown action %q (valid actions: %s)", name, strings.Join(verbs, ", "))
+}
+
+// actionVerb returns the --action short name of a Cedar action: the
+// lowercased name without its "Document" suffix, e.g. "view" for
+// ViewDocument, or the action itself for actions on other resources
+func actionVerb(action string) string {
+	short, ok := strings.CutSuffix(action, "Document")
+	if !ok || short == "" {
+		return action
+	}
+	return strings.ToLower(short)
+}
+
+// checkAllActions authorizes every action against the same entity slice
+func checkAllActions(policySet *cedar.PolicySet, slice *entitySlice, actions []cedar.EntityUID, requestContext cedar.RecordMap) ([]actionDecision, error) {
+	decisions := make([]actionDecision, 0, len(actions))
+	for _, actionUID := range actions {
+		start := time.Now()
+		allowed, diagnostic, err := checkAuthorization(policySet, slice, actionUID, requestContext)
+		if err != nil {
+			return nil, fmt.Errorf("authorization of %s failed: %w", actionUID.ID, err)
+		}
+		decisions = append(decisions, actionDecision{
+			Action:     actionUID,
+			Verb:       actionVerb(string(actionUID.ID)),
+			Allowed:    allowed,
+			Diagnostic: diagnostic,
+			Latency:    time.Since(start),
+		})
+	}
+	return decisions, nil
+}
+
+// writeActionDecisions prints the check-all decisions of userLabel on
+// documentID in the --output format, one line or row per action
+func writeActionDecisions(decisions []actionDecision, slice *entitySlice, policySet *cedar.PolicySet, userLabel, documentID, output string, explain bool, columnWidth int, color bool) error {
+	result := &checktable.Table{Header: checktable.Columns, MaxWidth: columnWidth, Color: color}
+	for _, decision := range decisions {
+		verdict := "deny"
+		if decision.Allowed {
+			verdict = "allow"
+		}
+		var why *explanation
+		if explain {
+			why = explainDecision(policySet, decision.Allowed, decision.Diagnostic)
+		}
+		switch output {
+		case "json":
+			encoded, err := json.Marshal(checkResult{
+				Principal:   slice.Principal.String(),
+				Action:      decision.Action.String(),
+				Resource:    slice.Resource.String(),
+				Decision:    verdict,
+				Explanation: why,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to encode result: %w", err)
+			}
+			fmt.Println(string(encoded))
+		case "table":
+			result.Rows = append(result.Rows, []string{
+				strings.ToUpper(verdict), "cedar", string(slice.Principal.ID), documentID, decision.Verb, checktable.FormatLatency(decision.Latency),
+			})
+		default:
+			if decision.Allowed {
+				fmt.Printf("✅ ALLOWED: %s can %s %s\n", userLabel, decision.Verb, documentID)
+			} else {
+				fmt.Printf("❌ DENIED: %s cannot %s %s\n", userLabel, decision.Verb, documentID)
+			}
+			if why != nil {
+				fmt.Println(why)
+			}
+		}
+	}
+	if output == "table" {
+		return result.Write(os.Stdout)
+	}
+	return nil
+}
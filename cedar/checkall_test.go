@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"simple-cedar-check/cedarload"
+)
+
+func TestParseDocumentAction(t *testing.T) {
+	cedarSchema, err := cedarload.LoadSchema(os.DirFS("."), "schema.cedarschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A schema with an extra document action, which --action must accept
+	// without any change to the code
+	archiving, err := cedarload.ParseSchema("archiving.cedarschema", []byte(`namespace DocumentManagement {
+    entity User;
+    entity Document;
+    action ViewDocument, ArchiveDocument appliesTo {
+        principal: User,
+        resource: Document,
+    };
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		schema     *cedarload.Schema
+		input      string
+		wantAction string
+		wantVerb   string
+		wantErr    string
+	}{
+		{name: "short name", schema: cedarSchema, input: "view", wantAction: "ViewDocument", wantVerb: "view"},
+		{name: "action name", schema: cedarSchema, input: "EditDocument", wantAction: "EditDocument", wantVerb: "edit"},
+		{name: "any case", schema: cedarSchema, input: "SHARE", wantAction: "ShareDocument", wantVerb: "share"},
+		{name: "action of another resource", schema: cedarSchema, input: "ViewFolder",
+			wantErr: `action "ViewFolder" does not apply to Document resources (applies to: Folder)`},
+		{name: "unknown", schema: cedarSchema, input: "archive",
+			wantErr: `unknown action "archive" (valid actions: delete, edit, share, view)`},
+		{name: "declared by the schema", schema: archiving, input: "archive", wantAction: "ArchiveDocument", wantVerb: "archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, verb, err := parseDocumentAction(tt.schema, tt.input)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action != tt.wantAction || verb != tt.wantVerb {
+				t.Errorf("got %s (%s), want %s (%s)", action, verb, tt.wantAction, tt.wantVerb)
+			}
+		})
+	}
+}
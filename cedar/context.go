@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/cedar-policy/cedar-go/types"
+)
+
+// ErrInvalidContext is returned when --context isn't a JSON object of values
+// Cedar can represent
+var ErrInvalidContext = errors.New("invalid request context")
+
+// parseContext parses the --context JSON object into the Cedar context
+// record. Objects become records and arrays sets; integers become longs and
+// numbers with a fraction decimals, which Cedar limits to four digits after
+// the point. null has no Cedar equivalent and is rejected.
+func parseContext(raw string) (cedar.RecordMap, error) {
+	if strings.TrimSpace(raw) == "" {
+		return cedar.RecordMap{}, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf(`%w: %v (expected a JSON object, e.g. {"mfa": true})`, ErrInvalidContext, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: trailing data after the JSON object", ErrInvalidContext)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf(`%w: expected a JSON object, e.g. {"mfa": true}`, ErrInvalidContext)
+	}
+	return contextRecord(fields, "")
+}
+
+func contextRecord(fields map[string]any, path string) (cedar.RecordMap, error) {
+	record := make(cedar.RecordMap, len(fields))
+	for key, raw := range fields {
+		value, err := contextValue(raw, joinContextKey(path, key))
+		if err != nil {
+			return nil, err
+		}
+		record[cedar.String(key)] = value
+	}
+	return record, nil
+}
+
+// contextValue converts a decoded JSON value at key, e.g. "device.ips[1]"
+func contextValue(raw any, key string) (cedar.Value, error) {
+	switch v := raw.(type) {
+	case bool:
+		return cedar.Boolean(v), nil
+	case string:
+		return cedar.String(v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return cedar.Long(n), nil
+		}
+		decimal, err := types.ParseDecimal(v.String())
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %s is neither a 64-bit integer nor a decimal with at most 4 fraction digits",
+				ErrInvalidContext, key, v)
+		}
+		return decimal, nil
+	case []any:
+		elements := make([]cedar.Value, len(v))
+		for i, element := range v {
+			value, err := contextValue(element, fmt.Sprintf("%s[%d]", key, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return cedar.NewSet(elements...), nil
+	case map[string]any:
+		record, err := contextRecord(v, key)
+		if err != nil {
+			return nil, err
+		}
+		return cedar.NewRecord(record), nil
+	case nil:
+		return nil, fmt.Errorf("%w: key %q: null is not supported, omit the key instead", ErrInvalidContext, key)
+	}
+	return nil, fmt.Errorf("%w: key %q: unsupported value %v", ErrInvalidContext, key, raw)
+}
+
+func joinContextKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
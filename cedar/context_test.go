@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// doc1EntityData is the entity data the Postgres query returns for userID
+// and doc1 in schema.sql, for a member of org
+func doc1EntityData(org string, isAdmin bool) *cedarauthz.EntityData {
+	folder, folderOrg, folderOwner := "folder1", "org1", "alice"
+	workspace, workspaceOrg := "ws1", "org1"
+	owner := "alice"
+	return &cedarauthz.EntityData{
+		UserOrganization:         org,
+		UserIsAdmin:              isAdmin,
+		DocumentID:               "doc1",
+		DocumentOrg:              "org1",
+		FolderID:                 &folder,
+		DocumentOwner:            &owner,
+		FolderOrg:                &folderOrg,
+		FolderOwner:              &folderOwner,
+		WorkspaceID:              &workspace,
+		WorkspaceOrg:             &workspaceOrg,
+		DocumentPermissions:      map[string][]string{},
+		FolderPermissions:        map[string][]string{"viewer": {"bob"}},
+		WorkspacePermissions:     map[string][]string{"admin": {"grace"}},
+		DocumentGroupPermissions: map[string][]string{},
+		FolderGroupPermissions:   map[string][]string{},
+	}
+}
+
+func TestParseContextRejectsNonObjects(t *testing.T) {
+	for _, raw := range []string{`null`, ` null `, `[true]`, `"mfa"`, `{"mfa": }`, `{} {}`} {
+		if _, err := parseContext(raw); !errors.Is(err, ErrInvalidContext) {
+			t.Errorf("parseContext(%q): got error %v, want ErrInvalidContext", raw, err)
+		}
+	}
+}
+
+// The admin delete policy is the example of a context-dependent policy: it
+// needs context.mfa, which openfga-check mirrors with the mfa_verified
+// condition
+func TestAdminDeleteRequiresMFA(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		isAdmin bool
+		context string
+		want    bool
+	}{
+		{"admin without context", "henry", true, "", false},
+		{"admin with mfa missing", "henry", true, `{"ip": "10.0.0.1"}`, false},
+		{"admin with mfa false", "henry", true, `{"mfa": false}`, false},
+		{"admin with mfa true", "henry", true, `{"mfa": true, "ip": "10.0.0.1"}`, true},
+		{"member with mfa true", "charlie", false, `{"mfa": true}`, false},
+	}
+	builders := map[string]entityBuilder{
+		"policies.cedar":           cedarauthz.BuildEntities,
+		"policies-hierarchy.cedar": cedarauthz.BuildHierarchyEntities,
+	}
+	deleteDocument := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), "DeleteDocument")
+	for policyFile, build := range builders {
+		policySet, err := cedarload.LoadPolicies(os.DirFS("."), policyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(policyFile+"/"+tt.name, func(t *testing.T) {
+				requestContext, err := parseContext(tt.context)
+				if err != nil {
+					t.Fatal(err)
+				}
+				slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, build, doc1EntityData("org1", tt.isAdmin), tt.userID, "doc1", entityLimits{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				allowed, _, err := checkAuthorization(policySet, slice, deleteDocument, requestContext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if allowed != tt.want {
+					t.Errorf("%s delete doc1 with context %q: got %v, want %v", tt.userID, tt.context, allowed, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// Organization admins are editors of every document of their organization,
+// and of no other organization's
+func TestOrganizationAdmins(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		org     string
+		isAdmin bool
+		action  cedar.String
+		want    bool
+	}{
+		{"admin views", "henry", "org1", true, "ViewDocument", true},
+		{"admin edits", "henry", "org1", true, "EditDocument", true},
+		{"admin shares", "henry", "org1", true, "ShareDocument", true},
+		{"admin of another organization can't view", "david", "org2", true, "ViewDocument", false},
+		{"admin of another organization can't edit", "david", "org2", true, "EditDocument", false},
+		{"member views", "charlie", "org1", false, "ViewDocument", true},
+		{"member can't edit", "charlie", "org1", false, "EditDocument", false},
+		{"member can't share", "charlie", "org1", false, "ShareDocument", false},
+	}
+	builders := map[string]entityBuilder{
+		"policies.cedar":           cedarauthz.BuildEntities,
+		"policies-hierarchy.cedar": cedarauthz.BuildHierarchyEntities,
+	}
+	for policyFile, build := range builders {
+		policySet, err := cedarload.LoadPolicies(os.DirFS("."), policyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(policyFile+"/"+tt.name, func(t *testing.T) {
+				slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, build, doc1EntityData(tt.org, tt.isAdmin), tt.userID, "doc1", entityLimits{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				action := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), tt.action)
+				allowed, _, err := checkAuthorization(policySet, slice, action, cedar.RecordMap{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if allowed != tt.want {
+					t.Errorf("%s %s doc1: got %v, want %v", tt.userID, tt.action, allowed, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// loadEntitySlice reads a Cedar entities JSON file, such as one written by
+// --dump-entities, and checks that it contains the principal and resource of
+// the request
+func loadEntitySlice(namespace cedarauthz.Namespace, path, userID, documentID string, limits entityLimits) (*entitySlice, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entities: %w", err)
+	}
+	var entities cedar.EntityMap
+	if err := json.Unmarshal(src, &entities); err != nil {
+		return nil, fmt.Errorf("failed to parse entities %s: %w", path, err)
+	}
+
+	userUID := cedar.NewEntityUID(namespace.User(), cedar.String(userID))
+	docUID := cedar.NewEntityUID(namespace.Document(), cedar.String(documentID))
+	var missing []string
+	for _, uid := range []cedar.EntityUID{userUID, docUID} {
+		if _, ok := entities[uid]; !ok {
+			missing = append(missing, uid.String())
+		}
+	}
+	if len(missing) > 0 {
+		err := fmt.Errorf("entities file %s has no %s", path, strings.Join(missing, " or "))
+		if _, ok := entities[docUID]; !ok {
+			err = fmt.Errorf("%w: %w", ErrDocumentNotFound, err)
+		}
+		return nil, err
+	}
+
+	stats := measureEntitySlice(entities, strategyFile)
+	if limits.exceededBy(stats) {
+		return &entitySlice{Stats: stats}, fmt.Errorf("%w: %s has %d entities and %d attribute values (limits %d/%d)",
+			ErrEntitySliceTooLarge, path, stats.Entities, stats.AttributeValues, limits.MaxEntities, limits.MaxAttributeValues)
+	}
+	return &entitySlice{Entities: entities, Principal: userUID, Resource: docUID, Stats: stats}, nil
+}
+
+// writeEntitiesFile writes entities to path with writeEntitiesJSON
+func writeEntitiesFile(path string, entities cedar.EntityMap) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeEntitiesJSON(f, entities); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeEntitiesJSON writes entities in the Cedar entities JSON format (uid,
+// attrs, parents) accepted by the Cedar CLI and playground. The output is
+// deterministic so dumps can be diffed across runs: entities are sorted by
+// UID, object keys are sorted and set members are sorted by their JSON
+// encoding.
+func writeEntitiesJSON(w io.Writer, entities cedar.EntityMap) error {
+	encoded, err := entities.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to encode entities: %w", err)
+	}
+
+	// Round-trip through generic values to sort the set members, keeping
+	// numbers as written
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var list []map[string]any
+	if err := decoder.Decode(&list); err != nil {
+		return fmt.Errorf("failed to encode entities: %w", err)
+	}
+	for _, entity := range list {
+		entity["attrs"] = sortSets(entity["attrs"])
+		// Older Cedar tools reject the tags key, and we never set tags
+		if tags, ok := entity["tags"].(map[string]any); ok && len(tags) == 0 {
+			delete(entity, "tags")
+		}
+	}
+
+	out, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode entities: %w", err)
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+// sortSets sorts every array in v, which inside attrs can only be a Cedar
+// set, by the JSON encoding of its members
+func sortSets(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = sortSets(child)
+		}
+	case []any:
+		for i := range v {
+			v[i] = sortSets(v[i])
+		}
+		slices.SortFunc(v, func(a, b any) int {
+			ea, _ := json.Marshal(a)
+			eb, _ := json.Marshal(b)
+			return bytes.Compare(ea, eb)
+		})
+	}
+	return v
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata golden files")
+
+// doc2EntityData is the entity data the Postgres query returns for charlie
+// and doc2 in schema.sql
+func doc2EntityData() *cedarauthz.EntityData {
+	folder, folderOrg, folderOwner := "folder1", "org1", "alice"
+	workspace, workspaceOrg := "ws1", "org1"
+	owner := "bob"
+	return &cedarauthz.EntityData{
+		UserOrganization: "org1",
+		DocumentID:       "doc2",
+		DocumentOrg:      "org1",
+		FolderID:         &folder,
+		DocumentOwner:    &owner,
+		FolderOrg:        &folderOrg,
+		FolderOwner:      &folderOwner,
+		WorkspaceID:      &workspace,
+		WorkspaceOrg:     &workspaceOrg,
+		DocumentPermissions: map[string][]string{
+			"editor": {"eve"},
+			"viewer": {"charlie"},
+		},
+		FolderPermissions:        map[string][]string{"viewer": {"bob"}},
+		WorkspacePermissions:     map[string][]string{"admin": {"grace"}},
+		DocumentGroupPermissions: map[string][]string{"viewer": {"apollo"}},
+		FolderGroupPermissions:   map[string][]string{},
+	}
+}
+
+func TestWriteEntitiesJSONIsDeterministic(t *testing.T) {
+	data := doc2EntityData()
+	// Several members per set, so an unsorted dump would vary between runs
+	data.DocumentPermissions["viewer"] = []string{"charlie", "alice", "henry", "bob"}
+	data.FolderPermissions["viewer"] = []string{"bob", "grace", "alice"}
+
+	var first []byte
+	for i := range 50 {
+		entities, _, _ := cedarauthz.BuildEntities(data, "charlie", "doc2")
+		var buf bytes.Buffer
+		if err := writeEntitiesJSON(&buf, entities); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if i == 0 {
+			first = buf.Bytes()
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatalf("run %d dumped different entities:\n%s\nwant:\n%s", i, buf.Bytes(), first)
+		}
+	}
+}
+
+func TestDumpEntitiesGolden(t *testing.T) {
+	slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, doc2EntityData(), "charlie", "doc2", entityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeEntitiesJSON(&buf, slice.Entities); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "dump-entities-charlie-doc2.json")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("--dump-entities output differs from %s (rerun with -update to accept):\n%s", golden, buf.Bytes())
+	}
+}
+
+// --entity-parents swaps BuildEntities and policies.cedar for
+// BuildHierarchyEntities and policies-hierarchy.cedar, which must decide
+// every check of the fixture the same way
+func TestEntityBuildersAgree(t *testing.T) {
+	attributes, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hierarchy, err := cedarload.LoadPolicies(os.DirFS("."), "policies-hierarchy.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A few decisions of document-management.fga.yaml, so that agreeing
+	// on denying everything fails
+	want := map[string]bool{
+		"alice/ViewDocument/doc1":     true,
+		"bob/EditDocument/doc4":       true,
+		"charlie/EditDocument/doc2":   false,
+		"david/ViewDocument/doc1":     false,
+		"eve/ViewDocument/doc2":       true,
+		"eve/ViewDocument/doc6":       true,
+		"frank/DeleteDocument/doc5":   true,
+		"frank/EditDocument/doc6":     true,
+		"grace/EditDocument/doc4":     false,
+		"henry/EditDocument/doc1":     true,
+		"mallory/ViewDocument/doc7":   true,
+		"mallory/ViewDocument/doc3":   false,
+		"henry/DeleteDocument/doc1":   false,
+		"henry/DeleteDocument/doc1+m": true,
+	}
+	contexts := map[string]cedar.RecordMap{"": {}, "+m": {"mfa": cedar.True}}
+	actions := fixtureActions(t)
+
+	checks := 0
+	for _, userID := range fixtureUsers {
+		for documentID := range fixtureDocuments {
+			data := fixtureEntityData(userID, documentID)
+			for _, action := range actions {
+				actionUID := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), cedar.String(action))
+				for suffix, requestContext := range contexts {
+					key := userID + "/" + action + "/" + documentID + suffix
+					fromAttributes := checkFixture(t, attributes, cedarauthz.BuildEntities, data, userID, actionUID, requestContext)
+					fromHierarchy := checkFixture(t, hierarchy, cedarauthz.BuildHierarchyEntities, data, userID, actionUID, requestContext)
+					if fromAttributes != fromHierarchy {
+						t.Errorf("%s: policies.cedar says %v, policies-hierarchy.cedar says %v", key, fromAttributes, fromHierarchy)
+					}
+					if expected, ok := want[key]; ok && fromAttributes != expected {
+						t.Errorf("%s: got %v, want %v", key, fromAttributes, expected)
+					}
+					checks++
+				}
+			}
+		}
+	}
+	if checks != len(fixtureUsers)*len(fixtureDocuments)*len(actions)*len(contexts) {
+		t.Errorf("ran %d checks", checks)
+	}
+}
+
+// checkFixture authorizes userID to perform action on the document of data
+func checkFixture(t *testing.T, policySet *cedar.PolicySet, build entityBuilder, data *cedarauthz.EntityData, userID string, action cedar.EntityUID, requestContext cedar.RecordMap) bool {
+	t.Helper()
+	slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, build, data, userID, data.DocumentID, entityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, _, err := checkAuthorization(policySet, slice, action, requestContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allowed
+}
+
+// Every user and group a fixture check refers to is built, as a stub unless
+// it's the principal or one of its groups
+func TestFixtureEntityCounts(t *testing.T) {
+	tests := []struct {
+		userID, documentID string
+		want               int
+	}{
+		// charlie, doc2, folder1, ws1 and org1, and stubs of bob, eve, alice,
+		// grace and the apollo group
+		{"charlie", "doc2", 10},
+		// eve, doc6, folder5, folder4, folder3, org1 and org2, and stubs of
+		// alice and apollo
+		{"eve", "doc6", 9},
+		// frank and apollo, doc6, the three folders and both organizations,
+		// and stubs of alice and eve
+		{"frank", "doc6", 10},
+		// mallory, doc7, folder2 and org2, and stubs of david and eve
+		{"mallory", "doc7", 6},
+	}
+	for _, tt := range tests {
+		for name, build := range map[string]entityBuilder{"attributes": cedarauthz.BuildEntities, "hierarchy": cedarauthz.BuildHierarchyEntities} {
+			data := fixtureEntityData(tt.userID, tt.documentID)
+			slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, build, data, tt.userID, tt.documentID, entityLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slice.Stats.Entities != tt.want {
+				t.Errorf("%s %s with %s: got %d entities, want %d", tt.userID, tt.documentID, name, slice.Stats.Entities, tt.want)
+			}
+		}
+	}
+}
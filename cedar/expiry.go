@@ -0,0 +1,27 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// activeEntityData returns a copy of data without the document grants that
+// have expired at at, so the policies only see the grants still in effect.
+// A grant is honored while at is before its expires_at, like the
+// non_expired condition of the OpenFGA model.
+func activeEntityData(data *cedarauthz.EntityData, at time.Time) *cedarauthz.EntityData {
+	if len(data.DocumentExpirations) == 0 {
+		return data
+	}
+	active := *data
+	active.DocumentPermissions = make(map[string][]string, len(data.DocumentPermissions))
+	for permType, userIDs := range data.DocumentPermissions {
+		active.DocumentPermissions[permType] = slices.DeleteFunc(slices.Clone(userIDs), func(userID string) bool {
+			expiresAt, ok := data.DocumentExpirations[cedarauthz.DocumentGrant{PermissionType: permType, UserID: userID}]
+			return ok && !at.Before(expiresAt)
+		})
+	}
+	return &active
+}
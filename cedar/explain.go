@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+// Ways a decision can be reached, as reported by --explain
+const (
+	reasonPermit    = "permit"          // at least one permit matched and no forbid did
+	reasonForbid    = "forbid"          // a forbid matched, overriding any permits
+	reasonNoPermits = "no_permit_match" // nothing matched, so Cedar denied by default
+)
+
+// explanation describes which policies decided a request
+type explanation struct {
+	Reason   string              `json:"reason"`
+	Policies []determiningPolicy `json:"policies"`
+}
+
+// determiningPolicy is a policy that contributed to the decision
+type determiningPolicy struct {
+	ID       string `json:"id"`
+	Effect   string `json:"effect"`
+	Position string `json:"position"`
+}
+
+// explainDecision turns the diagnostic of cedar.Authorize into an
+// explanation. Cedar reports the matching permits for an allow and the
+// matching forbids for a deny, so a deny without reasons means no permit
+// matched.
+func explainDecision(policySet *cedar.PolicySet, allowed bool, diagnostic cedar.Diagnostic) *explanation {
+	// Authorize iterates policies in map order, so list them in source order
+	reasons := slices.Clone(diagnostic.Reasons)
+	slices.SortFunc(reasons, func(a, b cedar.DiagnosticReason) int {
+		if c := strings.Compare(a.Position.Filename, b.Position.Filename); c != 0 {
+			return c
+		}
+		return a.Position.Offset - b.Position.Offset
+	})
+
+	result := &explanation{Policies: []determiningPolicy{}}
+	for _, reason := range reasons {
+		effect := "permit"
+		if policy := policySet.Get(reason.PolicyID); policy != nil && policy.Effect() == cedar.Forbid {
+			effect = "forbid"
+		}
+		result.Policies = append(result.Policies, determiningPolicy{
+			ID:       string(reason.PolicyID),
+			Effect:   effect,
+			Position: fmt.Sprintf("%s:%d:%d", reason.Position.Filename, reason.Position.Line, reason.Position.Column),
+		})
+	}
+
+	switch {
+	case allowed:
+		result.Reason = reasonPermit
+	case len(result.Policies) > 0:
+		result.Reason = reasonForbid
+	default:
+		result.Reason = reasonNoPermits
+	}
+	return result
+}
+
+// String renders the explanation as the line printed under the decision
+func (e *explanation) String() string {
+	if e.Reason == reasonNoPermits {
+		return "🔎 No permit policy matched (denied by default)"
+	}
+	var policies []string
+	for _, p := range e.Policies {
+		policies = append(policies, fmt.Sprintf("%s %s (%s)", p.Effect, p.ID, p.Position))
+	}
+	verb := "Permitted by"
+	if e.Reason == reasonForbid {
+		verb = "Forbidden by"
+	}
+	return fmt.Sprintf("🔎 %s %s", verb, strings.Join(policies, ", "))
+}
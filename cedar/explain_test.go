@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+func TestExplainForbidOverridesPermit(t *testing.T) {
+	policies, err := os.ReadFile("policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"policies/policies.cedar": {Data: policies},
+		"policies/freeze.cedar": {Data: []byte(`@id("freeze-doc2")
+forbid (principal, action, resource == DocumentManagement::Document::"doc2");`)},
+	}
+	frozen, err := cedarload.LoadPolicies(fsys, "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := cedarload.LoadPolicies(fsys, "policies/policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// david is in org2, so the organization permit doesn't apply to doc2
+	outsider := doc2EntityData()
+	outsider.UserOrganization = "org2"
+
+	tests := []struct {
+		name       string
+		policySet  *cedar.PolicySet
+		data       *cedarauthz.EntityData
+		userID     string
+		wantAllow  bool
+		wantReason string
+		wantEffect string // effect of every determining policy
+	}{
+		{"viewer is permitted", standard, doc2EntityData(), "charlie", true, reasonPermit, "permit"},
+		{"forbid overrides the viewer permit", frozen, doc2EntityData(), "charlie", false, reasonForbid, "forbid"},
+		{"no grant", standard, outsider, "david", false, reasonNoPermits, ""},
+	}
+	view := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), "ViewDocument")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, tt.data, tt.userID, "doc2", entityLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			allowed, diagnostic, err := checkAuthorization(tt.policySet, slice, view, cedar.RecordMap{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.wantAllow {
+				t.Errorf("got allowed %v, want %v", allowed, tt.wantAllow)
+			}
+			why := explainDecision(tt.policySet, allowed, diagnostic)
+			if why.Reason != tt.wantReason {
+				t.Errorf("got reason %s, want %s", why.Reason, tt.wantReason)
+			}
+			if tt.wantEffect != "" && len(why.Policies) == 0 {
+				t.Errorf("no determining policies, want %s policies", tt.wantEffect)
+			}
+			for _, policy := range why.Policies {
+				if policy.Effect != tt.wantEffect {
+					t.Errorf("policy %s has effect %s, want %s", policy.ID, policy.Effect, tt.wantEffect)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// The standard fixture of schema.sql, for tests that need the entity data of
+// every user and document without a database. The document side is the
+// folded result of the entity query, written out by hand;
+// TestGetEntityDataFixtureDocument checks the folding once against the rows
+// Postgres returns.
+
+var (
+	// fixtureUsers are the users of schema.sql and mallory, who has no rows
+	fixtureUsers = []string{"alice", "bob", "charlie", "david", "eve", "frank", "grace", "henry", "mallory"}
+
+	fixtureMembers = map[string]struct {
+		org     string
+		isAdmin bool
+	}{
+		"alice": {"org1", false}, "bob": {"org1", false}, "charlie": {"org1", false},
+		"david": {"org2", true}, "eve": {"org2", false}, "frank": {"org2", false},
+		"grace": {"org1", false}, "henry": {"org1", true},
+	}
+	fixtureGroupMembers = map[string][]string{"frank": {"apollo"}}
+
+	// fixtureDocuments set the document side of the entity data of each
+	// document
+	fixtureDocuments = map[string]func(data *cedarauthz.EntityData){
+		"doc1": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc1", "org1", "alice")
+			setFixtureFolder1(data)
+		},
+		"doc2": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc2", "org1", "bob")
+			setFixtureFolder1(data)
+			data.DocumentPermissions["viewer"] = []string{"charlie"}
+			data.DocumentPermissions["editor"] = []string{"eve"}
+			data.DocumentGroupPermissions["viewer"] = []string{"apollo"}
+		},
+		"doc3": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc3", "org2", "david")
+			setFixtureFolder2(data)
+		},
+		"doc4": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc4", "org1", "alice")
+			setFixtureFolder(data, "root_folder_org1", "org1", "alice")
+			data.DocumentPermissions["editor"] = []string{"bob"}
+			data.DocumentPermissions["viewer"] = []string{"charlie", "david"}
+			data.DocumentExpirations[cedarauthz.DocumentGrant{PermissionType: "viewer", UserID: "david"}] = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		},
+		"doc5": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc5", "org1", "frank")
+			setFixtureFolder1(data)
+		},
+		// folder5 is in folder4, which is in folder3: alice owns the
+		// ancestors, eve views folder3 and apollo edits folder4
+		"doc6": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc6", "org1", "alice")
+			setFixtureFolder(data, "folder5", "org1", "alice")
+			data.FolderAncestors = []cedarauthz.FolderAncestor{{ID: "folder4", Organization: "org1"}, {ID: "folder3", Organization: "org1"}}
+			data.FolderPermissions["viewer"] = []string{"eve"}
+			data.FolderPermissions["editor"] = []string{"alice"}
+			data.FolderGroupPermissions["editor"] = []string{"apollo"}
+		},
+		"doc7": func(data *cedarauthz.EntityData) {
+			setFixtureDocument(data, "doc7", "org2", "david")
+			setFixtureFolder2(data)
+			data.DocumentPublic = true
+		},
+	}
+)
+
+func setFixtureDocument(data *cedarauthz.EntityData, id, org, owner string) {
+	data.DocumentID, data.DocumentOrg, data.DocumentOwner = id, org, &owner
+}
+
+func setFixtureFolder(data *cedarauthz.EntityData, id, org, owner string) {
+	data.FolderID, data.FolderOrg, data.FolderOwner = &id, &org, &owner
+}
+
+// setFixtureFolder1 sets folder1 of workspace ws1, which bob views and grace
+// administers
+func setFixtureFolder1(data *cedarauthz.EntityData) {
+	setFixtureFolder(data, "folder1", "org1", "alice")
+	workspace, workspaceOrg := "ws1", "org1"
+	data.WorkspaceID, data.WorkspaceOrg = &workspace, &workspaceOrg
+	data.FolderPermissions["viewer"] = []string{"bob"}
+	data.WorkspacePermissions["admin"] = []string{"grace"}
+}
+
+// setFixtureFolder2 sets folder2, which eve edits
+func setFixtureFolder2(data *cedarauthz.EntityData) {
+	setFixtureFolder(data, "folder2", "org2", "david")
+	data.FolderPermissions["editor"] = []string{"eve"}
+}
+
+// fixtureEntityData returns the entity data the Postgres query returns for
+// userID and documentID in schema.sql
+func fixtureEntityData(userID, documentID string) *cedarauthz.EntityData {
+	data := newEntityData()
+	member := fixtureMembers[userID]
+	data.UserOrganization, data.UserIsAdmin = member.org, member.isAdmin
+	data.UserGroups = fixtureGroupMembers[userID]
+	fixtureDocuments[documentID](data)
+	return data
+}
+
+// fixtureActions returns the actions of schema.cedarschema that apply to
+// documents
+func fixtureActions(t testing.TB) []string {
+	t.Helper()
+	cedarSchema, err := cedarload.LoadSchema(os.DirFS("."), "schema.cedarschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return documentActionNames(cedarSchema)
+}
@@ -5,8 +5,12 @@ go 1.23.0
 toolchain go1.24.5
 
 require (
+	checktable v0.0.0
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/cedar-policy/cedar-go v1.2.6
 	github.com/lib/pq v1.10.9
 )
 
 require golang.org/x/exp v0.0.0-20220921023135-46d9e7742f1e // indirect
+
+replace checktable => ../checktable
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Identifier kinds accepted by --by
+const (
+	identifierAuto  = "auto"
+	identifierID    = "id"
+	identifierEmail = "email"
+	identifierName  = "name"
+)
+
+// userCandidate is a users row matching an identifier
+type userCandidate struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// resolveUserID resolves an email or display name to the canonical user ID.
+// IDs are returned unchanged; in auto mode identifiers containing "@" are
+// treated as emails and everything else as an ID.
+func resolveUserID(ctx context.Context, db *sql.DB, identifier, by string) (string, error) {
+	if by == identifierAuto {
+		by = identifierID
+		if strings.Contains(identifier, "@") {
+			by = identifierEmail
+		}
+	}
+
+	var query string
+	switch by {
+	case identifierID:
+		return identifier, nil
+	case identifierEmail:
+		query = `SELECT id, name, COALESCE(email, '') FROM users WHERE lower(email) = lower($1) ORDER BY id`
+	case identifierName:
+		query = `SELECT id, name, COALESCE(email, '') FROM users WHERE lower(name) = lower($1) ORDER BY id`
+	default:
+		return "", fmt.Errorf("unknown identifier kind %q (valid kinds: %s, %s, %s, %s)",
+			by, identifierAuto, identifierID, identifierEmail, identifierName)
+	}
+
+	rows, err := db.QueryContext(ctx, query, identifier)
+	if err != nil {
+		return "", fmt.Errorf("user lookup failed: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []userCandidate
+	for rows.Next() {
+		var c userCandidate
+		if err := rows.Scan(&c.ID, &c.Name, &c.Email); err != nil {
+			return "", fmt.Errorf("user lookup scan failed: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("user lookup failed: %w", err)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no user found with %s %q", by, identifier)
+	case 1:
+		return candidates[0].ID, nil
+	default:
+		var listed []string
+		for _, c := range candidates {
+			listed = append(listed, fmt.Sprintf("%s (%s <%s>)", c.ID, c.Name, c.Email))
+		}
+		return "", fmt.Errorf("%s %q is ambiguous, candidates: %s", by, identifier, strings.Join(listed, ", "))
+	}
+}
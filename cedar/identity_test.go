@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestResolveUserID(t *testing.T) {
+	userColumns := []string{"id", "name", "email"}
+	tests := []struct {
+		name       string
+		identifier string
+		by         string
+		query      string // empty when no lookup may run
+		rows       [][]string
+		want       string
+		wantErr    string
+	}{
+		{
+			name:       "ID",
+			identifier: "charlie",
+			by:         identifierAuto,
+			want:       "charlie",
+		},
+		{
+			name:       "email",
+			identifier: "Charlie@TechCorp.com",
+			by:         identifierAuto,
+			query:      `WHERE lower\(email\) = lower\(\$1\)`,
+			rows:       [][]string{{"charlie", "Charlie", "charlie@techcorp.com"}},
+			want:       "charlie",
+		},
+		{
+			name:       "no match",
+			identifier: "zoe@techcorp.com",
+			by:         identifierEmail,
+			query:      `WHERE lower\(email\) = lower\(\$1\)`,
+			wantErr:    `no user found with email "zoe@techcorp.com"`,
+		},
+		{
+			name:       "ambiguous name",
+			identifier: "Alex",
+			by:         identifierName,
+			query:      `WHERE lower\(name\) = lower\(\$1\)`,
+			rows: [][]string{
+				{"alex1", "Alex", "alex@techcorp.com"},
+				{"alex2", "alex", "alex@startup.io"},
+			},
+			wantErr: `name "Alex" is ambiguous, candidates: alex1 (Alex <alex@techcorp.com>), alex2 (alex <alex@startup.io>)`,
+		},
+		{
+			name:       "unknown kind",
+			identifier: "charlie",
+			by:         "username",
+			wantErr:    `unknown identifier kind "username" (valid kinds: auto, id, email, name)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if tt.query != "" {
+				rows := sqlmock.NewRows(userColumns)
+				for _, row := range tt.rows {
+					rows.AddRow(row[0], row[1], row[2])
+				}
+				mock.ExpectQuery(tt.query).WithArgs(tt.identifier).WillReturnRows(rows)
+			}
+
+			got, err := resolveUserID(context.Background(), db, tt.identifier, tt.by)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got %q, error %v, want error %q", got, err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// ErrEntitySliceTooLarge is returned when a check would build more entities or
+// attribute values than the configured limits allow
+var ErrEntitySliceTooLarge = errors.New("entity slice too large")
+
+// Entity slice strategies reported in verbose output
+const (
+	// strategyFull materializes every editor and viewer in the permission sets
+	strategyFull = "full"
+	// strategyMinimal keeps only the principal and its groups in the permission
+	// sets, which yields the same decisions since policies only test the
+	// principal's membership
+	strategyMinimal = "minimal"
+	// strategyFile uses the entities of an --entities file as they are
+	strategyFile = "file"
+)
+
+// entityLimits caps the entity slice built per check; zero disables a cap
+type entityLimits struct {
+	MaxEntities        int
+	MaxAttributeValues int
+	// Fallback switches to the minimal strategy instead of failing the check
+	Fallback bool
+}
+
+// exceededBy reports whether stats go over any enabled cap
+func (l entityLimits) exceededBy(stats *entitySliceStats) bool {
+	return (l.MaxEntities > 0 && stats.Entities > l.MaxEntities) ||
+		(l.MaxAttributeValues > 0 && stats.AttributeValues > l.MaxAttributeValues)
+}
+
+// entitySliceStats describes the entity slice built for a single check
+type entitySliceStats struct {
+	Strategy        string `json:"strategy"`
+	Entities        int    `json:"entities"`
+	AttributeValues int    `json:"attribute_values"`
+	EstimatedBytes  int    `json:"estimated_bytes"`
+}
+
+func (s *entitySliceStats) String() string {
+	return fmt.Sprintf("strategy=%s entities=%d attribute_values=%d estimated_bytes=%d",
+		s.Strategy, s.Entities, s.AttributeValues, s.EstimatedBytes)
+}
+
+// measureEntitySlice counts entities and attribute values, where each set
+// member counts as one value, and estimates the size from the JSON encoding
+func measureEntitySlice(entities cedar.EntityMap, strategy string) *entitySliceStats {
+	stats := &entitySliceStats{Strategy: strategy, Entities: len(entities)}
+	for _, entity := range entities {
+		for _, value := range entity.Attributes.All() {
+			if set, ok := value.(cedar.Set); ok {
+				stats.AttributeValues += set.Len()
+			} else {
+				stats.AttributeValues++
+			}
+		}
+	}
+	if encoded, err := json.Marshal(entities); err == nil {
+		stats.EstimatedBytes = len(encoded)
+	}
+	return stats
+}
+
+// minimalEntityData returns a copy of data whose permission lists only keep
+// userID and its groups, so the permission sets hold at most the principal
+func minimalEntityData(data *cedarauthz.EntityData, userID string) *cedarauthz.EntityData {
+	minimal := *data
+	minimal.DocumentPermissions = onlyUser(data.DocumentPermissions, userID)
+	minimal.FolderPermissions = onlyUser(data.FolderPermissions, userID)
+	minimal.WorkspacePermissions = onlyUser(data.WorkspacePermissions, userID)
+	minimal.DocumentGroupPermissions = onlyGroups(data.DocumentGroupPermissions, data.UserGroups)
+	minimal.FolderGroupPermissions = onlyGroups(data.FolderGroupPermissions, data.UserGroups)
+	return &minimal
+}
+
+// onlyGroups keeps the groups of groupIDs, i.e. the principal's groups
+func onlyGroups(permissions map[string][]string, groupIDs []string) map[string][]string {
+	result := make(map[string][]string, len(permissions))
+	for permType, ids := range permissions {
+		for _, id := range ids {
+			if slices.Contains(groupIDs, id) {
+				result[permType] = append(result[permType], id)
+			}
+		}
+	}
+	return result
+}
+
+func onlyUser(permissions map[string][]string, userID string) map[string][]string {
+	result := make(map[string][]string, len(permissions))
+	for permType, userIDs := range permissions {
+		if slices.Contains(userIDs, userID) {
+			result[permType] = []string{userID}
+		}
+	}
+	return result
+}
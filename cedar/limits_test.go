@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// wideEntityData is doc2EntityData with extra document viewers and extra
+// folders above folder1
+func wideEntityData(viewers, ancestors int) *cedarauthz.EntityData {
+	data := doc2EntityData()
+	for i := range viewers {
+		data.DocumentPermissions["viewer"] = append(data.DocumentPermissions["viewer"], fmt.Sprintf("viewer%d", i))
+	}
+	for i := range ancestors {
+		data.FolderAncestors = append(data.FolderAncestors, cedarauthz.FolderAncestor{ID: fmt.Sprintf("ancestor%d", i), Organization: "org1"})
+	}
+	return data
+}
+
+func TestBuildEntitySliceLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      *cedarauthz.EntityData
+		limits    entityLimits
+		wantErr   bool
+		wantStrat string
+	}{
+		{"no limits", wideEntityData(500, 20), entityLimits{}, false, strategyFull},
+		{"under both limits", doc2EntityData(), entityLimits{MaxEntities: 100, MaxAttributeValues: 100}, false, strategyFull},
+		{"max entities", wideEntityData(0, 20), entityLimits{MaxEntities: 10}, true, strategyFull},
+		{"max attribute values", wideEntityData(500, 0), entityLimits{MaxAttributeValues: 100}, true, strategyFull},
+		{"fallback", wideEntityData(500, 0), entityLimits{MaxAttributeValues: 100, Fallback: true}, false, strategyMinimal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, tt.data, "charlie", "doc2", tt.limits)
+			if tt.wantErr {
+				if !errors.Is(err, ErrEntitySliceTooLarge) {
+					t.Fatalf("got error %v, want ErrEntitySliceTooLarge", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if slice.Stats.Strategy != tt.wantStrat {
+				t.Errorf("got strategy %s, want %s", slice.Stats.Strategy, tt.wantStrat)
+			}
+		})
+	}
+}
+
+// The minimal slice of the fallback must reach the decisions of the full one
+func TestEntityLimitFallbackKeepsDecisions(t *testing.T) {
+	policySet, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := wideEntityData(500, 0)
+	full, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, data, "charlie", "doc2", entityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, data, "charlie", "doc2", entityLimits{MaxAttributeValues: 100, Fallback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limited.Stats.AttributeValues > 100 {
+		t.Errorf("minimal slice has %d attribute values, over the limit of 100", limited.Stats.AttributeValues)
+	}
+	for _, action := range fixtureActions(t) {
+		actionUID := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), cedar.String(action))
+		want, _, err := checkAuthorization(policySet, full, actionUID, cedar.RecordMap{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := checkAuthorization(policySet, limited, actionUID, cedar.RecordMap{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: minimal slice decided %v, full slice %v", action, got, want)
+		}
+	}
+}
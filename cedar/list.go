@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/lib/pq"
+
+	"checktable"
+	"simple-cedar-check/cedarauthz"
+)
+
+// candidateDocumentsQuery returns the documents a user may have any access
+// to: those of their organization, owned, public or shared with them or
+// their groups, and those below a folder they own, administer through a
+// workspace, or were granted (directly or through a group). It errs on the
+// side of too many candidates, since Cedar makes the decision.
+const candidateDocumentsQuery = `
+WITH RECURSIVE granted_folders AS (
+	SELECT folder_id AS id FROM folder_permissions WHERE user_id = $1
+	UNION
+	SELECT gp.folder_id
+	FROM folder_group_permissions gp
+	JOIN group_members gm ON gm.group_id = gp.group_id
+	WHERE gm.user_id = $1
+	UNION
+	SELECT id FROM folders WHERE owner_id = $1
+	UNION
+	SELECT f.id
+	FROM folders f
+	JOIN workspace_permissions wp ON wp.workspace_id = f.workspace_id
+	WHERE wp.user_id = $1
+	UNION
+	-- Grants apply to every nested folder; UNION stops on cycles
+	SELECT f.id
+	FROM folders f
+	JOIN granted_folders g ON f.parent_folder_id = g.id
+)
+SELECT d.id
+FROM documents d
+WHERE d.organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = $1)
+	OR d.owner_id = $1
+	OR d.is_public
+	OR d.folder_id IN (SELECT id FROM granted_folders)
+	OR d.id IN (SELECT document_id FROM document_permissions WHERE user_id = $1)
+	OR d.id IN (
+		SELECT gp.document_id
+		FROM document_group_permissions gp
+		JOIN group_members gm ON gm.group_id = gp.group_id
+		WHERE gm.user_id = $1
+	)
+ORDER BY d.id
+LIMIT $2
+`
+
+// queryCandidateDocuments returns at most limit candidate document IDs for
+// userID (0 for no limit), and whether more candidates were left out
+func queryCandidateDocuments(ctx context.Context, db *sql.DB, userID string, limit int) ([]string, bool, error) {
+	// Fetch one row past the limit so truncation can be reported
+	var rowLimit sql.NullInt64
+	if limit > 0 {
+		rowLimit = sql.NullInt64{Int64: int64(limit) + 1, Valid: true}
+	}
+	rows, err := db.QueryContext(ctx, candidateDocumentsQuery, userID, rowLimit)
+	if err != nil {
+		return nil, false, fmt.Errorf("candidate query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, fmt.Errorf("candidate scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("candidate iteration failed: %w", err)
+	}
+	if limit > 0 && len(ids) > limit {
+		return ids[:limit], true, nil
+	}
+	return ids, false, nil
+}
+
+// candidateList is the result of list-documents or list-users, with the
+// time spent in each phase so it can be compared with OpenFGA's ListObjects
+// and ListUsers
+type candidateList struct {
+	Allowed    []string
+	Candidates int
+	Truncated  bool // the candidates were capped by --limit
+
+	CandidateQuery time.Duration
+	EntityLoading  time.Duration
+	Evaluation     time.Duration
+}
+
+func (l *candidateList) String() string {
+	truncated := ""
+	if l.Truncated {
+		truncated = " (capped by --limit)"
+	}
+	return fmt.Sprintf("%d of %d candidates allowed%s: candidate query %s, entity loading %s, evaluation %s",
+		len(l.Allowed), l.Candidates, truncated,
+		checktable.FormatLatency(l.CandidateQuery), checktable.FormatLatency(l.EntityLoading), checktable.FormatLatency(l.Evaluation))
+}
+
+// listDocuments finds the documents userID can perform action on: it
+// queries the candidates, builds the entities of every candidate, and then
+// authorizes each one against the shared policy set. The entity data of the
+// candidates the runner hasn't cached is loaded with a single query.
+func listDocuments(ctx context.Context, runner *batchRunner, userID, action string, limit int) (*candidateList, error) {
+	list := &candidateList{}
+	start := time.Now()
+	candidates, truncated, err := queryCandidateDocuments(ctx, runner.db, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	list.CandidateQuery = time.Since(start)
+	list.Candidates, list.Truncated = len(candidates), truncated
+
+	start = time.Now()
+	entitySlices, err := candidateSlices(ctx, runner, userID, candidates)
+	if err != nil {
+		return nil, err
+	}
+	list.EntityLoading = time.Since(start)
+
+	start = time.Now()
+	actionUID := cedar.NewEntityUID(runner.namespace.Action(), cedar.String(action))
+	runner.warnWithoutPermit(actionUID)
+	for i, documentID := range candidates {
+		allowed, _, err := checkAuthorization(runner.policySet, entitySlices[i], actionUID, runner.requestContext)
+		if err != nil {
+			return nil, fmt.Errorf("document %s: %w", documentID, err)
+		}
+		if allowed {
+			list.Allowed = append(list.Allowed, documentID)
+		}
+	}
+	list.Evaluation = time.Since(start)
+	return list, nil
+}
+
+// candidateSlices builds the entity slices of userID for every candidate
+// document. Documents missing from the runner's cache are loaded with one
+// GetEntityDataBatch query and cached, instead of one query each.
+func candidateSlices(ctx context.Context, runner *batchRunner, userID string, candidates []string) ([]*entitySlice, error) {
+	loaded := make(map[string]*cedarauthz.EntityData, len(candidates))
+	var missing []string
+	for _, documentID := range candidates {
+		if data, ok := runner.documents.get(documentID); ok {
+			loaded[documentID] = data
+		} else {
+			missing = append(missing, documentID)
+		}
+	}
+	if len(missing) > 0 {
+		queried, err := runner.repo.GetEntityDataBatch(ctx, userID, missing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query entity data: %w", err)
+		}
+		for documentID, data := range queried {
+			runner.documents.put(documentID, data)
+			loaded[documentID] = data
+			runner.users[userKey{userID, data.DocumentOrg}] = &userData{Organization: data.UserOrganization, IsAdmin: data.UserIsAdmin, Groups: data.UserGroups}
+		}
+	}
+
+	entitySlices := make([]*entitySlice, len(candidates))
+	for i, documentID := range candidates {
+		data, ok := loaded[documentID]
+		if !ok {
+			// Deleted between the candidate query and the entity query
+			return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, documentID)
+		}
+		var err error
+		if entitySlices[i], err = runner.sliceFromData(ctx, userID, documentID, data); err != nil {
+			return nil, fmt.Errorf("document %s: %w", documentID, err)
+		}
+	}
+	return entitySlices, nil
+}
+
+// candidateUsersQuery returns the principals that may have any access to a
+// document, together with the principal data the batch runner caches: the
+// owner, members of its organization, direct and group shares, and the
+// owners, grantees and workspace admins of its folder and every ancestor.
+// Like candidateDocumentsQuery, it errs on the side of too many candidates.
+const candidateUsersQuery = `
+WITH RECURSIVE folder_chain AS (
+	SELECT f.id, f.owner_id, f.workspace_id, f.parent_folder_id
+	FROM folders f
+	JOIN documents d ON d.folder_id = f.id
+	WHERE d.id = $1
+	UNION
+	SELECT p.id, p.owner_id, p.workspace_id, p.parent_folder_id
+	FROM folders p
+	JOIN folder_chain fc ON p.id = fc.parent_folder_id
+),
+candidates AS (
+	SELECT owner_id AS user_id FROM documents WHERE id = $1
+	UNION
+	SELECT om.user_id
+	FROM organization_members om
+	JOIN documents d ON d.organization_id = om.organization_id
+	WHERE d.id = $1
+	UNION
+	SELECT user_id FROM document_permissions WHERE document_id = $1
+	UNION
+	SELECT gm.user_id
+	FROM document_group_permissions gp
+	JOIN group_members gm ON gm.group_id = gp.group_id
+	WHERE gp.document_id = $1
+	UNION
+	SELECT owner_id FROM folder_chain
+	UNION
+	SELECT fp.user_id
+	FROM folder_permissions fp
+	JOIN folder_chain fc ON fc.id = fp.folder_id
+	UNION
+	SELECT gm.user_id
+	FROM folder_group_permissions gp
+	JOIN folder_chain fc ON fc.id = gp.folder_id
+	JOIN group_members gm ON gm.group_id = gp.group_id
+	UNION
+	SELECT wp.user_id
+	FROM workspace_permissions wp
+	JOIN folder_chain fc ON fc.workspace_id = wp.workspace_id
+)
+SELECT c.user_id, uo.organization_id, COALESCE(uo.is_admin, false),
+	ARRAY(SELECT group_id FROM group_members WHERE user_id = c.user_id ORDER BY group_id)
+FROM candidates c
+-- A member of several organizations gets the document's, as in GetEntityData
+LEFT JOIN LATERAL (
+	SELECT organization_id, is_admin
+	FROM organization_members
+	WHERE user_id = c.user_id
+	ORDER BY organization_id = (SELECT organization_id FROM documents WHERE id = $1) DESC, organization_id
+	LIMIT 1
+) uo ON true
+WHERE c.user_id IS NOT NULL
+ORDER BY c.user_id
+LIMIT $2
+`
+
+// candidateUser is a row of candidateUsersQuery
+type candidateUser struct {
+	ID   string
+	Data *userData
+}
+
+// queryCandidateUsers returns at most limit candidate principals for
+// documentID (0 for no limit), ordered by ID, and whether more candidates
+// were left out
+func queryCandidateUsers(ctx context.Context, db *sql.DB, documentID string, limit int) ([]candidateUser, bool, error) {
+	var rowLimit sql.NullInt64
+	if limit > 0 {
+		rowLimit = sql.NullInt64{Int64: int64(limit) + 1, Valid: true}
+	}
+	rows, err := db.QueryContext(ctx, candidateUsersQuery, documentID, rowLimit)
+	if err != nil {
+		return nil, false, fmt.Errorf("candidate query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var users []candidateUser
+	for rows.Next() {
+		var id string
+		var org sql.NullString
+		var groups pq.StringArray
+		user := &userData{}
+		if err := rows.Scan(&id, &org, &user.IsAdmin, &groups); err != nil {
+			return nil, false, fmt.Errorf("candidate scan failed: %w", err)
+		}
+		user.Organization = org.String
+		user.Groups = groups
+		users = append(users, candidateUser{ID: id, Data: user})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("candidate iteration failed: %w", err)
+	}
+	if limit > 0 && len(users) > limit {
+		return users[:limit], true, nil
+	}
+	return users, false, nil
+}
+
+// anyUser is the principal list-users authorizes on behalf of users outside
+// the candidates: no organization, admin flag, groups or shares. When it is
+// allowed, every user is, which ListUsers reports as user:*.
+const anyUser = "*"
+
+// listUsers finds the principals that can perform action on documentID. The
+// candidate query also returns each candidate's principal data, so the
+// document's entity data is queried once and reused for every candidate.
+// "*" is listed first when a user with no relation to the document is
+// allowed too, e.g. for public documents.
+func listUsers(ctx context.Context, runner *batchRunner, documentID, action string, limit int) (*candidateList, error) {
+	list := &candidateList{}
+	start := time.Now()
+	candidates, truncated, err := queryCandidateUsers(ctx, runner.db, documentID, limit)
+	if err != nil {
+		return nil, err
+	}
+	list.CandidateQuery = time.Since(start)
+	candidates = append([]candidateUser{{ID: anyUser, Data: &userData{}}}, candidates...)
+	list.Candidates, list.Truncated = len(candidates), truncated
+
+	start = time.Now()
+	data, err := runner.documentData(ctx, anyUser, documentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		runner.users[userKey{candidate.ID, data.DocumentOrg}] = candidate.Data
+	}
+	entitySlices := make([]*entitySlice, len(candidates))
+	for i, candidate := range candidates {
+		if entitySlices[i], err = runner.sliceFromData(ctx, candidate.ID, documentID, data); err != nil {
+			return nil, fmt.Errorf("user %s: %w", candidate.ID, err)
+		}
+	}
+	list.EntityLoading = time.Since(start)
+
+	start = time.Now()
+	actionUID := cedar.NewEntityUID(runner.namespace.Action(), cedar.String(action))
+	runner.warnWithoutPermit(actionUID)
+	for i, candidate := range candidates {
+		allowed, _, err := checkAuthorization(runner.policySet, entitySlices[i], actionUID, runner.requestContext)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", candidate.ID, err)
+		}
+		if allowed {
+			list.Allowed = append(list.Allowed, candidate.ID)
+		}
+	}
+	list.Evaluation = time.Since(start)
+	return list, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// doc1Row is doc2Row for doc1, which alice owns in folder1
+func doc1Row(permUserID, permType, resourceType string) []driver.Value {
+	row := doc2Row(permUserID, permType, resourceType)
+	row[2], row[5] = "doc1", "alice"
+	return row
+}
+
+// newListRunner returns a batchRunner for list-documents on a sqlmock
+// database whose candidate query returns candidates
+func newListRunner(t *testing.T, userID string, candidates ...string) (*batchRunner, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range candidates {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery("SELECT d.id").WithArgs(userID, nil).WillReturnRows(rows)
+
+	policySet, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &batchRunner{
+		db:             db,
+		policySet:      policySet,
+		repo:           &postgresRepository{db: db},
+		namespace:      cedarauthz.DefaultNamespace,
+		build:          cedarauthz.BuildEntities,
+		requestContext: cedar.RecordMap{},
+		documents:      newEntityCache(0, 0),
+		users:          make(map[userKey]*userData),
+		resolved:       make(map[string]string),
+		warned:         make(map[string]bool),
+	}, mock
+}
+
+func TestListDocumentsQueriesEntitiesOnce(t *testing.T) {
+	runner, mock := newListRunner(t, "eve", "doc1", "doc2")
+	// A single entity query for both candidates
+	mock.ExpectBegin()
+	mock.ExpectQuery("WHERE d.id = ANY\\(\\$2\\)").WithArgs("eve", sqlmock.AnyArg(), nil, 0).
+		WillReturnRows(sqlmock.NewRows(entityColumns).
+			AddRow(doc1Row("bob", "viewer", "folder")...).
+			AddRow(doc2Row("eve", "editor", "document")...).
+			AddRow(doc2Row("charlie", "viewer", "document")...))
+	mock.ExpectRollback()
+
+	list, err := listDocuments(context.Background(), runner, "eve", "EditDocument", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(list.Allowed, []string{"doc2"}) || list.Candidates != 2 {
+		t.Errorf("got %v of %d candidates, want [doc2] of 2", list.Allowed, list.Candidates)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// The loaded documents are cached, so listing again queries no entities
+	mock.ExpectQuery("SELECT d.id").WithArgs("eve", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("doc1").AddRow("doc2"))
+	if _, err := listDocuments(context.Background(), runner, "eve", "EditDocument", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListDocumentsMissingCandidate(t *testing.T) {
+	runner, mock := newListRunner(t, "eve", "doc2", "doc9")
+	// doc9 was deleted after the candidate query, so it has no rows
+	mock.ExpectBegin()
+	mock.ExpectQuery("WHERE d.id = ANY\\(\\$2\\)").WithArgs("eve", sqlmock.AnyArg(), nil, 0).
+		WillReturnRows(sqlmock.NewRows(entityColumns).AddRow(doc2Row("eve", "editor", "document")...))
+	mock.ExpectRollback()
+
+	_, err := listDocuments(context.Background(), runner, "eve", "EditDocument", 0)
+	if !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("got error %v, want ErrDocumentNotFound", err)
+	}
+}
+
+// Candidates in two organizations get the document's, like GetEntityData
+// gives them
+func TestCandidateUsersInTwoOrganizations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// zoe is a member of org1 and an admin of org2, which doc3 is in
+	mock.ExpectQuery(`ORDER BY organization_id = \(SELECT organization_id FROM documents WHERE id = \$1\) DESC, organization_id\s+LIMIT 1`).
+		WithArgs("doc3", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "organization_id", "is_admin", "groups"}).AddRow("zoe", "org2", true, "{}"))
+
+	users, _, err := queryCandidateUsers(context.Background(), db, "doc3", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Data.Organization != "org2" || !users[0].Data.IsAdmin {
+		t.Errorf("got %+v, want zoe as an admin of org2", users)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/cedar-policy/cedar-go"
-	_ "github.com/lib/pq"
+
+	"checktable"
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
 )
 
 // Note: This example demonstrates schema usage concepts.
@@ -19,284 +29,571 @@ import (
 // 3. IDE support - enables autocompletion and error checking
 // 4. Documentation - serves as a contract for the authorization model
 
-// EntityData holds all the data needed to build Cedar entities
-type EntityData struct {
-	UserOrganization    string
-	DocumentID          string
-	DocumentOrg         string
-	FolderID            *string
-	DocumentOwner       *string
-	FolderOrg           *string
-	FolderOwner         *string
-	DocumentPermissions map[string][]string // permissionType -> userIDs
-	FolderPermissions   map[string][]string // permissionType -> userIDs
+// entitySlice is the set of Cedar entities built for a single check
+type entitySlice struct {
+	Entities  cedar.EntityMap
+	Principal cedar.EntityUID
+	Resource  cedar.EntityUID
+	Stats     *entitySliceStats
 }
 
-// queryEntityData retrieves all entity data needed for Cedar authorization
-func queryEntityData(db *sql.DB, userID, documentID string) (*EntityData, error) {
-	query := `
-	WITH user_org AS (
-		SELECT organization_id as user_org_id
-		FROM organization_members 
-		WHERE user_id = $1 
-		LIMIT 1
-	),
-	doc_info AS (
-		SELECT d.id as doc_id, d.organization_id as doc_org_id, 
-			   d.folder_id, d.owner_id as doc_owner_id,
-			   f.organization_id as folder_org_id, f.owner_id as folder_owner_id
-		FROM documents d
-		LEFT JOIN folders f ON d.folder_id = f.id
-		WHERE d.id = $2
-	),
-	doc_perms AS (
-		SELECT dp.document_id, dp.user_id, dp.permission_type, 'document' as resource_type
-		FROM document_permissions dp
-		WHERE dp.document_id = $2
-	),
-	folder_perms AS (
-		SELECT fp.folder_id as document_id, fp.user_id, fp.permission_type, 'folder' as resource_type
-		FROM folder_permissions fp
-		JOIN doc_info di ON fp.folder_id = di.folder_id
-		WHERE di.folder_id IS NOT NULL
-	)
-	SELECT 
-		uo.user_org_id,
-		di.doc_id,
-		di.doc_org_id,
-		di.folder_id,
-		di.doc_owner_id,
-		di.folder_org_id,
-		di.folder_owner_id,
-		COALESCE(dp.user_id, '') as perm_user_id,
-		COALESCE(dp.permission_type, '') as perm_type,
-		COALESCE(dp.resource_type, '') as resource_type
-	FROM user_org uo
-	CROSS JOIN doc_info di
-	LEFT JOIN (
-		SELECT * FROM doc_perms
-		UNION ALL
-		SELECT * FROM folder_perms
-	) dp ON true
-	`
-
-	rows, err := db.Query(query, userID, documentID)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+// entityBuilder builds the Cedar entities of a check from its data:
+// Namespace.BuildEntities, or Namespace.BuildHierarchyEntities with
+// --entity-parents
+type entityBuilder func(data *cedarauthz.EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID)
+
+// buildEntitySlice builds Cedar entities from data with build, the builder
+// of namespace, and enforces the entity slice limits, falling back to the
+// minimal strategy when allowed. It fails with
+// cedarauthz.ErrDanglingReference if the builder left out an entity that
+// the others refer to.
+func buildEntitySlice(namespace cedarauthz.Namespace, build entityBuilder, data *cedarauthz.EntityData, userID, documentID string, limits entityLimits) (*entitySlice, error) {
+	entities, userUID, docUID := build(data, userID, documentID)
+	stats := measureEntitySlice(entities, strategyFull)
+	if limits.exceededBy(stats) {
+		if !limits.Fallback {
+			return &entitySlice{Stats: stats}, fmt.Errorf("%w: document %s built %d entities and %d attribute values (limits %d/%d)",
+				ErrEntitySliceTooLarge, documentID, stats.Entities, stats.AttributeValues, limits.MaxEntities, limits.MaxAttributeValues)
+		}
+		entities, userUID, docUID = build(minimalEntityData(data, userID), userID, documentID)
+		stats = measureEntitySlice(entities, strategyMinimal)
+	}
+	if err := namespace.CheckReferences(entities); err != nil {
+		return &entitySlice{Stats: stats}, err
 	}
-	defer rows.Close()
+	return &entitySlice{Entities: entities, Principal: userUID, Resource: docUID, Stats: stats}, nil
+}
+
+// checkResult is the --output json form of a check
+type checkResult struct {
+	Principal   string            `json:"principal"`
+	Action      string            `json:"action"`
+	Resource    string            `json:"resource"`
+	Decision    string            `json:"decision"` // "allow" or "deny", or "error" in --batch
+	Explanation *explanation      `json:"explanation,omitempty"`
+	EntitySlice *entitySliceStats `json:"entity_slice,omitempty"`
+	Timing      *checkTiming      `json:"timing,omitempty"`
+	Line        int               `json:"line,omitempty"`  // line of the --batch file
+	Error       string            `json:"error,omitempty"` // why a --batch line failed
+}
 
-	data := &EntityData{
-		DocumentPermissions: make(map[string][]string),
-		FolderPermissions:   make(map[string][]string),
+// checkAuthorization performs the authorization check for actionUID against
+// the entity slice and request context, returning Cedar's diagnostic for
+// --explain
+func checkAuthorization(policySet *cedar.PolicySet, slice *entitySlice, actionUID cedar.EntityUID, requestContext cedar.RecordMap) (bool, cedar.Diagnostic, error) {
+	return cedarauthz.Authorize(policySet, slice.Entities, slice.Principal, actionUID, slice.Resource, requestContext)
+}
+
+// Exit statuses of a single check, so scripts can tell a denial from a
+// mistyped document ID or a broken setup
+const (
+	exitDenied   = 1
+	exitError    = 2
+	exitNotFound = 3 // ErrDocumentNotFound or ErrUserNotInOrganization
+)
+
+// exitCode returns the exit status for a failed check
+func exitCode(err error) int {
+	if errors.Is(err, ErrDocumentNotFound) || errors.Is(err, ErrUserNotInOrganization) {
+		return exitNotFound
 	}
+	return exitError
+}
+
+// fatal logs like log.Fatal but exits with exitError, since status 1 means
+// the check was denied
+func fatal(v ...any) {
+	log.Print(v...)
+	os.Exit(exitError)
+}
+
+// fatalf is fatal with a format
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(exitError)
+}
 
-	for rows.Next() {
-		var userOrg, docID, docOrg, folderID, docOwner, folderOrg, folderOwner sql.NullString
-		var permUserID, permType, resourceTypeCol string
+func main() {
+	var limits entityLimits
+	flag.IntVar(&limits.MaxEntities, "max-entities", 10000, "maximum entities built per check (0 disables the cap)")
+	flag.IntVar(&limits.MaxAttributeValues, "max-attribute-values", 100000, "maximum attribute values, counting each set member, built per check (0 disables the cap)")
+	flag.BoolVar(&limits.Fallback, "entity-limit-fallback", false, "fall back to principal-only permission sets instead of failing when a cap is exceeded")
+	var guards queryGuards
+	flag.DurationVar(&guards.StatementTimeout, "statement-timeout", 5*time.Second, "Postgres statement_timeout for the entity query (0 disables it)")
+	flag.IntVar(&guards.MaxRows, "max-permission-rows", 10000, "abort when the entity query returns more permission rows (0 disables the cap)")
+	flag.IntVar(&guards.MaxFolderDepth, "max-folder-depth", 16, "maximum levels of parent folders whose permissions are inherited")
+	by := flag.String("by", identifierAuto, "how to interpret the user argument: auto, id, email or name")
+	verbose := flag.Bool("verbose", false, "print the size of the entity slice built for the check")
+	timing := flag.Bool("timing", false, "print how long the entity query, entity building and policy evaluation of the check took")
+	actionName := flag.String("action", "view", "document action to check: a short name such as view or edit, or any action of schema.cedarschema that applies to documents")
+	policiesPath := flag.String("policies", "policies.cedar", "Cedar policy file, or a directory whose *.cedar files are merged")
+	namespaceName := flag.String("namespace", string(cedarauthz.DefaultNamespace), "Cedar namespace of the entity types and actions; schema.cedarschema must declare it")
+	templatesPath := flag.String("templates", "", "link the @permission templates of this Cedar file once per document_permissions row instead of building editors and viewers attributes, e.g. templates.cedar")
+	entityParents := flag.Bool("entity-parents", false, "make documents and folders children of their folder and organization, for policies using \"in\" such as policies-hierarchy.cedar")
+	entitiesPath := flag.String("entities", "", "load Cedar entities from this JSON file instead of querying Postgres; the user argument is then a user ID")
+	dumpEntities := flag.String("dump-entities", "", "write the entities built for the check to this file in the Cedar entities JSON format")
+	atFlag := flag.String("at", "", "evaluate time-bounded shares at this RFC3339 time instead of now, e.g. 2025-06-01T00:00:00Z")
+	contextJSON := flag.String("context", "", `request context as a JSON object, e.g. '{"mfa": true}'`)
+	explain := flag.Bool("explain", false, "print the policies that decided the request")
+	output := flag.String("output", "text", "output format: text, json or table")
+	wide := flag.Bool("wide", false, "don't truncate long IDs in --output table")
+	forceColor := flag.Bool("color", false, "color --output table decisions even when stdout is not a terminal")
+	noColor := flag.Bool("no-color", false, "never color --output table decisions")
+	candidateLimit := flag.Int("limit", 1000, "maximum candidates list-documents and list-users evaluate (0 disables the cap)")
+	cacheTTL := flag.Duration("cache-ttl", 0, "how long --batch and list modes reuse a document's entity data (0 keeps it until evicted)")
+	cacheSize := flag.Int("cache-size", 1000, "maximum documents whose entity data --batch and list modes cache (0 disables the bound)")
+	batchPath := flag.String("batch", "", "run the checks of a file of userID,action,documentID lines (CSV or JSONL) instead of a single check")
+	watch := flag.Bool("watch", false, "reload the policies when they change and re-run the check each time Enter is pressed, linking --templates grants again first")
+	skipSchemaValidation := flag.Bool("skip-schema-validation", false, "don't validate the policies against schema.cedarschema at startup")
+	strict := flag.Bool("strict", false, "fail with exit status 3 instead of denying when the user belongs to no organization")
+	flag.Parse()
 
-		err := rows.Scan(&userOrg, &docID, &docOrg, &folderID, &docOwner,
-			&folderOrg, &folderOwner, &permUserID, &permType, &resourceTypeCol)
+	if flag.Arg(0) == "policy" && flag.Arg(1) == "check" {
+		ok, err := runPolicyCheck(os.DirFS("."), flag.Args()[2:])
 		if err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+			fatal("Policy check failed:", err)
 		}
-
-		// Set basic entity data (only on first row)
-		if data.DocumentID == "" {
-			data.UserOrganization = userOrg.String
-			data.DocumentID = docID.String
-			data.DocumentOrg = docOrg.String
-			if folderID.Valid {
-				data.FolderID = &folderID.String
-			}
-			if docOwner.Valid {
-				data.DocumentOwner = &docOwner.String
-			}
-			if folderOrg.Valid {
-				data.FolderOrg = &folderOrg.String
-			}
-			if folderOwner.Valid {
-				data.FolderOwner = &folderOwner.String
-			}
+		if !ok {
+			os.Exit(1)
 		}
+		return
+	}
 
-		// Process permissions
-		if permUserID != "" && permType != "" {
-			if resourceTypeCol == "document" {
-				data.DocumentPermissions[permType] = append(
-					data.DocumentPermissions[permType], permUserID)
-			} else if resourceTypeCol == "folder" {
-				data.FolderPermissions[permType] = append(
-					data.FolderPermissions[permType], permUserID)
+	if flag.NArg() < 2 && *batchPath == "" {
+		fatal("Usage: ./cedar-check [flags] <user> <documentID>\n       ./cedar-check [flags] --batch <file>\n       ./cedar-check [flags] list-documents <user>\n       ./cedar-check [flags] list-users <documentID>\n       ./cedar-check [flags] check-all <user> <documentID>\n       ./cedar-check policy check [--against-version <version>] [policies.cedar]")
+	}
+	if *batchPath != "" && (*watch || *dumpEntities != "" || *timing) {
+		fatal("Invalid request: --batch can't be combined with --watch, --dump-entities or --timing")
+	}
+	// Templates are linked from the document_permissions table
+	if *templatesPath != "" && *entitiesPath != "" {
+		fatal("Invalid request: --templates can't be combined with --entities")
+	}
+	userInput, documentID := flag.Arg(0), flag.Arg(1)
+	checkAll := flag.Arg(0) == "check-all"
+	if checkAll {
+		if flag.NArg() < 3 {
+			fatal("Usage: ./cedar-check [flags] check-all <user> <documentID>")
+		}
+		userInput, documentID = flag.Arg(1), flag.Arg(2)
+		if *batchPath != "" || *watch || *timing {
+			fatal("Invalid request: check-all can't be combined with --batch, --watch or --timing")
+		}
+	}
+	listMode := flag.Arg(0) == "list-documents" || flag.Arg(0) == "list-users"
+	if listMode {
+		if flag.Arg(0) == "list-documents" {
+			userInput, documentID = flag.Arg(1), ""
+		} else {
+			userInput, documentID = "", flag.Arg(1)
+			// The candidates include "*", which belongs to no organization
+			if *strict {
+				fatal("Invalid request: list-users can't be combined with --strict")
 			}
 		}
+		if *batchPath != "" || *watch || *entitiesPath != "" || *dumpEntities != "" || *explain || *output != "text" || *timing {
+			fatalf("Invalid request: %s can't be combined with --batch, --watch, --entities, --dump-entities, --explain, --output or --timing", flag.Arg(0))
+		}
 	}
-
-	return data, nil
-}
-
-// checkAuthorization builds Cedar entities from data and performs authorization check
-func checkAuthorization(policySet *cedar.PolicySet, data *EntityData, userID, documentID string) (bool, error) {
-	// Build Cedar entities
-	entities := cedar.EntityMap{}
-
-	// User entity
-	userAttrs := cedar.RecordMap{}
-	if data.UserOrganization != "" {
-		orgUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Organization"), cedar.String(data.UserOrganization))
-		userAttrs["organization"] = cedar.EntityUID(orgUID)
-		entities[orgUID] = cedar.Entity{
-			UID:        orgUID,
-			Attributes: cedar.NewRecord(cedar.RecordMap{"name": cedar.String(data.UserOrganization)}),
+	if *output != "text" && *output != "json" && *output != "table" {
+		fatalf("Invalid request: unknown output format %q (valid formats: text, json, table)", *output)
+	}
+	if *output == "table" && *explain {
+		fatal("Invalid request: --explain is not supported with --output table")
+	}
+	requestContext, err := parseContext(*contextJSON)
+	if err != nil {
+		fatal("Invalid request:", err)
+	}
+	var at time.Time
+	if *atFlag != "" {
+		at, err = time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			fatal("Invalid request: --at must be an RFC3339 time:", err)
 		}
 	}
-	userUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(userID))
-	entities[userUID] = cedar.Entity{
-		UID:        userUID,
-		Attributes: cedar.NewRecord(userAttrs),
+	columnWidth := checktable.DefaultColumnWidth
+	if *wide {
+		columnWidth = 0
+	}
+	color := checktable.UseColor(*forceColor, *noColor)
+	namespace := cedarauthz.Namespace(*namespaceName)
+	build := entityBuilder(namespace.BuildEntities)
+	if *entityParents {
+		build = namespace.BuildHierarchyEntities
+	}
+	if *templatesPath != "" {
+		build = withoutDocumentPermissions(build)
 	}
 
-	// Document entity
-	docAttrs := cedar.RecordMap{"name": cedar.String(data.DocumentID)}
-	if data.DocumentOrg != "" {
-		orgUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Organization"), cedar.String(data.DocumentOrg))
-		docAttrs["organization"] = cedar.EntityUID(orgUID)
+	// Load the schema so invalid action/resource combinations are rejected
+	// before hitting the database
+	fsys := os.DirFS(".")
+	cedarSchema, err := cedarload.LoadSchema(fsys, "schema.cedarschema")
+	if err != nil {
+		fatal("Failed to load schema:", err)
 	}
-	if data.DocumentOwner != nil {
-		ownerUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(*data.DocumentOwner))
-		docAttrs["owner"] = cedar.EntityUID(ownerUID)
+	if cedarSchema.Namespace != string(namespace) {
+		fatalf("Invalid request: schema.cedarschema declares namespace %q, not %q; pass --namespace %s", cedarSchema.Namespace, namespace, cedarSchema.Namespace)
 	}
-	if data.FolderID != nil {
-		folderUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Folder"), cedar.String(*data.FolderID))
-		docAttrs["parent_folder"] = cedar.EntityUID(folderUID)
+	action, verb, err := parseDocumentAction(cedarSchema, *actionName)
+	if err != nil {
+		fatal("Invalid request:", err)
 	}
 
-	// Add document permissions (editors, viewers)
-	if len(data.DocumentPermissions["editor"]) > 0 {
-		var editorValues []cedar.Value
-		for _, editorID := range data.DocumentPermissions["editor"] {
-			editorUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(editorID))
-			editorValues = append(editorValues, cedar.EntityUID(editorUID))
+	// Connect to database, unless the entities come from a file
+	var db *sql.DB
+	var repo EntityRepository
+	userID := userInput
+	if *entitiesPath == "" {
+		db, err = sql.Open("postgres", "user=postgres password=password host=localhost port=5432 dbname=cedar sslmode=disable")
+		if err != nil {
+			fatal("DB connection failed:", err)
+		}
+		defer db.Close()
+		repo = &postgresRepository{db: db, guards: guards}
+
+		// Resolve emails and names to the canonical user ID used in entities;
+		// batch lines are resolved one by one
+		if *batchPath == "" && userInput != "" {
+			userID, err = resolveUserID(context.Background(), db, userInput, *by)
+			if err != nil {
+				fatal("Failed to resolve user:", err)
+			}
 		}
-		docAttrs["editors"] = cedar.NewSet(editorValues...)
-	} else {
-		docAttrs["editors"] = cedar.NewSet()
 	}
-	if len(data.DocumentPermissions["viewer"]) > 0 {
-		var viewerValues []cedar.Value
-		for _, viewerID := range data.DocumentPermissions["viewer"] {
-			viewerUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(viewerID))
-			viewerValues = append(viewerValues, cedar.EntityUID(viewerUID))
-		}
-		docAttrs["viewers"] = cedar.NewSet(viewerValues...)
-	} else {
-		docAttrs["viewers"] = cedar.NewSet()
+	userLabel := userID
+	if userInput != userID {
+		userLabel = fmt.Sprintf("%s (%s)", userInput, userID)
+	}
+
+	// Load Cedar policies
+	policiesDir, policiesName := filepath.Split(filepath.Clean(*policiesPath))
+	if policiesDir == "" {
+		policiesDir = "."
+	}
+	policiesFS := os.DirFS(policiesDir)
+	var templates []policyTemplate
+	if *templatesPath != "" {
+		templatesDir, templatesName := filepath.Split(filepath.Clean(*templatesPath))
+		if templatesDir == "" {
+			templatesDir = "."
+		}
+		templates, err = loadTemplates(os.DirFS(templatesDir), templatesName, namespace)
+		if err != nil {
+			fatal("Failed to load templates:", err)
+		}
 	}
+	actionUID := cedar.NewEntityUID(namespace.Action(), cedar.String(action))
+	load := func() (*cedar.PolicySet, error) {
+		policySet, err := cedarload.LoadPolicies(policiesFS, policiesName)
+		if err != nil {
+			return nil, err
+		}
 
-	// Create folder entity if exists
-	if data.FolderID != nil {
-		// Add folder entity
-		folderAttrs := cedar.RecordMap{"name": cedar.String(*data.FolderID)}
-		if data.FolderOrg != nil {
-			orgUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Organization"), cedar.String(*data.FolderOrg))
-			folderAttrs["organization"] = cedar.EntityUID(orgUID)
-		}
-		if data.FolderOwner != nil {
-			ownerUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(*data.FolderOwner))
-			folderAttrs["owner"] = cedar.EntityUID(ownerUID)
-		}
-
-		// Add folder permissions (editors, viewers)
-		if len(data.FolderPermissions["editor"]) > 0 {
-			var editorValues []cedar.Value
-			for _, editorID := range data.FolderPermissions["editor"] {
-				editorUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(editorID))
-				editorValues = append(editorValues, cedar.EntityUID(editorUID))
+		// Fail fast on policies that reference undeclared actions, entity
+		// types or attributes, which would otherwise surface as evaluation
+		// errors or silent denies
+		if !*skipSchemaValidation {
+			issues, err := validatePolicies(cedarSchema, policySet)
+			if err != nil {
+				return nil, fmt.Errorf("failed to validate policies: %w", err)
+			}
+			if templates != nil {
+				templateIssues, err := validatePolicies(cedarSchema, sampleLinks(templates, namespace))
+				if err != nil {
+					return nil, fmt.Errorf("failed to validate templates: %w", err)
+				}
+				issues = append(issues, templateIssues...)
+			}
+			for _, issue := range issues {
+				log.Printf("❌ %s", issue)
+			}
+			if len(issues) > 0 {
+				return nil, fmt.Errorf("policies don't match schema.cedarschema (%d issues); use --skip-schema-validation to run anyway", len(issues))
 			}
-			folderAttrs["editors"] = cedar.NewSet(editorValues...)
-		} else {
-			folderAttrs["editors"] = cedar.NewSet()
 		}
 
-		if len(data.FolderPermissions["viewer"]) > 0 {
-			var viewerValues []cedar.Value
-			for _, viewerID := range data.FolderPermissions["viewer"] {
-				viewerUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::User"), cedar.String(viewerID))
-				viewerValues = append(viewerValues, cedar.EntityUID(viewerUID))
+		// Link the templates on every load, so --watch picks up new grants
+		// and drops expired ones when it reloads or re-checks
+		if templates != nil {
+			linkAt := at
+			if linkAt.IsZero() {
+				linkAt = time.Now()
+			}
+			links, err := linkTemplates(context.Background(), db, policySet, templates, namespace, linkAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to link templates: %w", err)
+			}
+			if *verbose {
+				log.Printf("Linked %d template policies from %s", links, *templatesPath)
 			}
-			folderAttrs["viewers"] = cedar.NewSet(viewerValues...)
-		} else {
-			folderAttrs["viewers"] = cedar.NewSet()
 		}
 
-		folderUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Folder"), cedar.String(*data.FolderID))
-		entities[folderUID] = cedar.Entity{
-			UID:        folderUID,
-			Attributes: cedar.NewRecord(folderAttrs),
+		// Warn when no permit can ever apply to the action, so an
+		// "everything is denied" outcome isn't mistaken for a regular
+		// decision. Batch mode warns for the actions of its lines instead,
+		// and check-all shows every action's decision anyway.
+		if *batchPath != "" || listMode || checkAll {
+			return policySet, nil
+		}
+		permits, err := permitsForAction(policySet, actionUID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze policies: %w", err)
+		}
+		if len(permits) == 0 {
+			log.Printf("⚠️  No permit policy applies to %s; every request for it will be denied", actionUID)
 		}
+		return policySet, nil
 	}
-	docUID := cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Document"), cedar.String(documentID))
-	entities[docUID] = cedar.Entity{
-		UID:        docUID,
-		Attributes: cedar.NewRecord(docAttrs),
+	policySet, err := load()
+	if err != nil {
+		fatal("Failed to load policies:", err)
 	}
 
-	// Create authorization request
-	request := cedar.Request{
-		Principal: userUID,
-		Action:    cedar.NewEntityUID(cedar.EntityType("DocumentManagement::Action"), cedar.String("ViewDocument")),
-		Resource:  docUID,
-		Context:   cedar.NewRecord(cedar.RecordMap{}),
+	if *batchPath != "" || listMode {
+		runner := &batchRunner{
+			db:             db,
+			policySet:      policySet,
+			schema:         cedarSchema,
+			by:             *by,
+			repo:           repo,
+			namespace:      namespace,
+			build:          build,
+			strict:         *strict,
+			limits:         limits,
+			at:             at,
+			requestContext: requestContext,
+			entitiesPath:   *entitiesPath,
+			explain:        *explain,
+			documents:      newEntityCache(*cacheTTL, *cacheSize),
+			users:          make(map[userKey]*userData),
+			resolved:       make(map[string]string),
+			warned:         make(map[string]bool),
+		}
+		if listMode && documentID != "" {
+			list, err := listUsers(context.Background(), runner, documentID, action, *candidateLimit)
+			if err != nil {
+				log.Print("Listing users failed:", err)
+				os.Exit(exitCode(err))
+			}
+			for _, id := range list.Allowed {
+				fmt.Println(id)
+			}
+			fmt.Fprintf(os.Stderr, "📋 Users who can %s %s: %s\n", verb, documentID, list)
+			return
+		}
+		if listMode {
+			list, err := listDocuments(context.Background(), runner, userID, action, *candidateLimit)
+			if err != nil {
+				log.Print("Listing documents failed:", err)
+				os.Exit(exitCode(err))
+			}
+			for _, id := range list.Allowed {
+				fmt.Println(id)
+			}
+			fmt.Fprintf(os.Stderr, "📋 %s can %s %s\n", userLabel, verb, list)
+			return
+		}
+		ok, err := runBatch(context.Background(), runner, *batchPath, *output, columnWidth, color)
+		if err != nil {
+			fatal("Batch failed:", err)
+		}
+		if !ok {
+			if db != nil {
+				db.Close()
+			}
+			os.Exit(exitError)
+		}
+		return
 	}
 
-	// Authorize
-	decision, diagnostic := cedar.Authorize(policySet, entities, request)
-	if len(diagnostic.Errors) > 0 {
-		return false, fmt.Errorf("authorization errors: %v", diagnostic.Errors)
-	}
+	// loadSlice builds the entities of the single check, recording the time
+	// spent querying and building them in elapsed
+	loadSlice := func(elapsed *checkTiming) (*entitySlice, error) {
+		var slice *entitySlice
+		var err error
+		start := time.Now()
+		if *entitiesPath != "" {
+			// The file is re-read on every check so edits show up in watch mode
+			slice, err = loadEntitySlice(namespace, *entitiesPath, userID, documentID, limits)
+		} else {
+			// Query database for ALL entity data needed for Cedar policies
+			var data *cedarauthz.EntityData
+			data, err = repo.GetEntityData(context.Background(), userID, documentID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to query entity data: %w", err)
+			}
+			elapsed.Query = time.Since(start)
+			start = time.Now()
+			if *strict {
+				if err := requireOrganization(data.UserOrganization, userID); err != nil {
+					return nil, err
+				}
+			}
 
-	return decision == cedar.Allow, nil
-}
+			// Drop the grants that have expired, at --at or else now
+			now := at
+			if now.IsZero() {
+				now = time.Now()
+			}
+			data = activeEntityData(data, now)
 
-func main() {
-	if len(os.Args) < 3 {
-		log.Fatal("Usage: ./cedar-check <userID> <documentID>")
+			// Build the entities, dumping them before authorizing so a
+			// surprising decision can be replayed in the Cedar CLI or
+			// playground
+			slice, err = buildEntitySlice(namespace, build, data, userID, documentID, limits)
+		}
+		elapsed.EntityBuild = time.Since(start)
+		if *verbose && *output == "text" && slice != nil && slice.Stats != nil {
+			fmt.Printf("📦 Entity slice: %s\n", slice.Stats)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("authorization failed: %w", err)
+		}
+		if *dumpEntities != "" {
+			if err := writeEntitiesFile(*dumpEntities, slice.Entities); err != nil {
+				return nil, fmt.Errorf("failed to dump entities: %w", err)
+			}
+		}
+		return slice, nil
 	}
-	userID, documentID := os.Args[1], os.Args[2]
 
-	// Connect to database
-	db, err := sql.Open("postgres", "user=postgres password=password host=localhost port=5432 dbname=cedar sslmode=disable")
-	if err != nil {
-		log.Fatal("DB connection failed:", err)
+	if checkAll {
+		start := time.Now()
+		slice, err := loadSlice(&checkTiming{})
+		if err != nil {
+			log.Print(err)
+			os.Exit(exitCode(err))
+		}
+		var actions []cedar.EntityUID
+		for _, name := range documentActionNames(cedarSchema) {
+			actions = append(actions, cedar.NewEntityUID(namespace.Action(), cedar.String(name)))
+		}
+		decisions, err := checkAllActions(policySet, slice, actions, requestContext)
+		if err != nil {
+			fatal(err)
+		}
+		if err := writeActionDecisions(decisions, slice, policySet, userLabel, documentID, *output, *explain, columnWidth, color); err != nil {
+			fatal("Failed to print results:", err)
+		}
+		if *output == "text" {
+			fmt.Printf("📋 %d actions checked in %s\n", len(decisions), checktable.FormatLatency(time.Since(start)))
+		}
+		return
 	}
-	defer db.Close()
 
-	// Load Cedar policies
-	policies, err := os.ReadFile("policies.cedar")
-	if err != nil {
-		log.Fatal("Failed to load policies:", err)
-	}
-	policySet, err := cedar.NewPolicySetFromBytes("policies.cedar", policies)
-	if err != nil {
-		log.Fatal("Failed to parse policies:", err)
-	}
+	// check runs the single check and reports whether it was allowed
+	check := func(policySet *cedar.PolicySet) (bool, error) {
+		start := time.Now()
+		var elapsed checkTiming
+		slice, err := loadSlice(&elapsed)
+		if err != nil {
+			return false, err
+		}
 
-	// Query database for ALL entity data needed for Cedar policies
-	data, err := queryEntityData(db, userID, documentID)
-	if err != nil {
-		log.Fatal("Failed to query entity data:", err)
+		// Perform authorization check
+		evalStart := time.Now()
+		allowed, diagnostic, err := checkAuthorization(policySet, slice, actionUID, requestContext)
+		if err != nil {
+			return false, fmt.Errorf("authorization failed: %w", err)
+		}
+		elapsed.Eval = time.Since(evalStart)
+		latency := time.Since(start)
+		elapsed.Total = latency
+		var why *explanation
+		if *explain {
+			why = explainDecision(policySet, allowed, diagnostic)
+		}
+
+		// Print result
+		if *output == "json" {
+			result := checkResult{
+				Principal:   slice.Principal.String(),
+				Action:      actionUID.String(),
+				Resource:    slice.Resource.String(),
+				Decision:    "deny",
+				Explanation: why,
+			}
+			if allowed {
+				result.Decision = "allow"
+			}
+			if *verbose {
+				result.EntitySlice = slice.Stats
+			}
+			if *timing {
+				result.Timing = &elapsed
+			}
+			encoded, err := json.Marshal(result)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode result: %w", err)
+			}
+			fmt.Println(string(encoded))
+			return allowed, nil
+		}
+		if *output == "table" {
+			decision := "DENY"
+			if allowed {
+				decision = "ALLOW"
+			}
+			result := &checktable.Table{
+				Header:   checktable.Columns,
+				Rows:     [][]string{{decision, "cedar", userID, documentID, verb, checktable.FormatLatency(latency)}},
+				MaxWidth: columnWidth,
+				Color:    color,
+			}
+			err := result.Write(os.Stdout)
+			// Keep the table parseable
+			if *timing {
+				fmt.Fprintf(os.Stderr, "⏱️  Timing: %s\n", &elapsed)
+			}
+			return allowed, err
+		}
+		if allowed {
+			fmt.Printf("✅ ALLOWED: %s can %s %s\n", userLabel, verb, documentID)
+		} else {
+			fmt.Printf("❌ DENIED: %s cannot %s %s\n", userLabel, verb, documentID)
+		}
+		if why != nil {
+			fmt.Println(why)
+		}
+		if *timing {
+			fmt.Printf("⏱️  Timing: %s\n", &elapsed)
+		}
+		return allowed, nil
 	}
 
-	// Perform authorization check
-	allowed, err := checkAuthorization(policySet, data, userID, documentID)
-	if err != nil {
-		log.Fatal("Authorization failed:", err)
+	if !*watch {
+		allowed, err := check(policySet)
+		if err != nil {
+			log.Print(err)
+			os.Exit(exitCode(err))
+		}
+		if !allowed {
+			if db != nil {
+				db.Close()
+			}
+			os.Exit(exitDenied)
+		}
+		return
 	}
 
-	// Print result
-	if allowed {
-		fmt.Printf("✅ ALLOWED: %s can view %s\n", userID, documentID)
-	} else {
-		fmt.Printf("❌ DENIED: %s cannot view %s\n", userID, documentID)
+	// Watch mode: reload policies as they change and re-check on Enter
+	watcher := newPolicyWatcher(policiesFS, policiesName, policySet, load)
+	go watcher.run(context.Background(), time.Second)
+	fmt.Printf("👀 Watching %s; press Enter to re-check, Ctrl-D to quit\n", *policiesPath)
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		if _, err := check(watcher.PolicySet()); err != nil {
+			log.Print(err)
+		}
+		if !input.Scan() {
+			return
+		}
+		// Grants change without the policy file changing, so link the
+		// templates again before every re-check
+		if templates != nil {
+			watcher.reload()
+		}
 	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// namespacedFS returns the schema and policies of the working directory with
+// the DocumentManagement namespace renamed to namespace, as the README asks
+// for when reusing the checker
+func namespacedFS(t *testing.T, namespace string) fstest.MapFS {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"schema.cedarschema", "policies.cedar"} {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed := strings.ReplaceAll(string(src), "namespace DocumentManagement", "namespace "+namespace)
+		renamed = strings.ReplaceAll(renamed, "DocumentManagement::", namespace+"::")
+		fsys[name] = &fstest.MapFile{Data: []byte(renamed)}
+	}
+	return fsys
+}
+
+// Every check of the fixture decides the same under DocumentManagement and
+// another namespace, with the schema, policies and entities all renamed
+func TestNamespacesDecideAlike(t *testing.T) {
+	namespaces := []cedarauthz.Namespace{cedarauthz.DefaultNamespace, "Acme::Docs"}
+	policySets := make(map[cedarauthz.Namespace]*cedar.PolicySet)
+	for _, namespace := range namespaces {
+		fsys := namespacedFS(t, string(namespace))
+		cedarSchema, err := cedarload.LoadSchema(fsys, "schema.cedarschema")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cedarSchema.Namespace != string(namespace) {
+			t.Fatalf("schema declares %q, want %q", cedarSchema.Namespace, namespace)
+		}
+		policySet, err := cedarload.LoadPolicies(fsys, "policies.cedar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		issues, err := validatePolicies(cedarSchema, policySet)
+		if err != nil || len(issues) > 0 {
+			t.Fatalf("%s policies don't validate: %v %v", namespace, issues, err)
+		}
+		policySets[namespace] = policySet
+	}
+
+	actions := fixtureActions(t)
+	allowed := 0
+	for _, userID := range fixtureUsers {
+		for documentID := range fixtureDocuments {
+			data := fixtureEntityData(userID, documentID)
+			for _, action := range actions {
+				decisions := make(map[cedarauthz.Namespace]bool)
+				for _, namespace := range namespaces {
+					slice, err := buildEntitySlice(namespace, namespace.BuildEntities, data, userID, documentID, entityLimits{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					for uid := range slice.Entities {
+						if !strings.HasPrefix(string(uid.Type), string(namespace)+"::") {
+							t.Fatalf("entity %s is outside namespace %s", uid, namespace)
+						}
+					}
+					actionUID := cedar.NewEntityUID(namespace.Action(), cedar.String(action))
+					decisions[namespace], _, err = checkAuthorization(policySets[namespace], slice, actionUID, cedar.RecordMap{})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				if decisions[namespaces[0]] != decisions[namespaces[1]] {
+					t.Errorf("%s %s %s: got %v", userID, action, documentID, decisions)
+				}
+				if decisions[namespaces[0]] {
+					allowed++
+				}
+			}
+		}
+	}
+	if allowed == 0 {
+		t.Error("no check of the fixture was allowed")
+	}
+}
+
+// Entities of one namespace never match policies of another, which is why
+// cedar-check refuses to start when --namespace and the schema disagree
+func TestNamespaceMismatchDenies(t *testing.T) {
+	policySet, err := cedarload.LoadPolicies(namespacedFS(t, "Acme::Docs"), "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, fixtureEntityData("alice", "doc1"), "alice", "doc1", entityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewDocument := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), "ViewDocument")
+	allowed, _, err := checkAuthorization(policySet, slice, viewDocument, cedar.RecordMap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Error("alice can view doc1 with DocumentManagement entities and Acme::Docs policies")
+	}
+}
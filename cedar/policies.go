@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+// jsonActionScope mirrors the action scope of the Cedar JSON policy format
+type jsonActionScope struct {
+	Op       string          `json:"op"`
+	Entity   *jsonEntityRef  `json:"entity"`
+	Entities []jsonEntityRef `json:"entities"`
+}
+
+type jsonEntityRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// permitsForAction returns the IDs of the permit policies whose action scope
+// can match action. When it is empty, Cedar denies every request for the
+// action by default, which is otherwise indistinguishable from a regular deny.
+func permitsForAction(policySet *cedar.PolicySet, action cedar.EntityUID) ([]cedar.PolicyID, error) {
+	var ids []cedar.PolicyID
+	for id, policy := range policySet.All() {
+		if policy.Effect() != cedar.Permit {
+			continue
+		}
+		encoded, err := policy.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect policy %s: %w", id, err)
+		}
+		var scope struct {
+			Action jsonActionScope `json:"action"`
+		}
+		if err := json.Unmarshal(encoded, &scope); err != nil {
+			return nil, fmt.Errorf("failed to inspect policy %s: %w", id, err)
+		}
+		if scope.Action.matches(action) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// matches reports whether the scope can match action. The schema declares no
+// action groups, so "in" matches the listed actions themselves.
+func (s jsonActionScope) matches(action cedar.EntityUID) bool {
+	if s.Op == "All" {
+		return true
+	}
+	refs := s.Entities
+	if s.Entity != nil {
+		refs = append(refs, *s.Entity)
+	}
+	for _, ref := range refs {
+		if ref.Type == string(action.Type) && ref.ID == string(action.ID) {
+			return true
+		}
+	}
+	return false
+}
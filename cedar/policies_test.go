@@ -0,0 +1,106 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+func TestLoadPoliciesReportsBrokenFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"policies/a.cedar": {Data: []byte("permit (principal, action, resource);\n")},
+		"policies/b.cedar": {Data: []byte("// sharing\npermit (principal, action, resource)\nwhen { principal.owner == };\n")},
+		"policies/c.cedar": {Data: []byte("forbid (principal, action, resource);\n")},
+	}
+	_, err := cedarload.LoadPolicies(fsys, "policies")
+	var parseErr *cedarload.PolicyParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got error %v, want a PolicyParseError", err)
+	}
+	if parseErr.File != "policies/b.cedar" || parseErr.Line != 3 || parseErr.Column != 28 {
+		t.Errorf("got position %s:%d:%d, want policies/b.cedar:3:28", parseErr.File, parseErr.Line, parseErr.Column)
+	}
+	if parseErr.Snippet != "when { principal.owner == };" {
+		t.Errorf("got snippet %q", parseErr.Snippet)
+	}
+}
+
+func TestLoadPoliciesForbidWinsAcrossFiles(t *testing.T) {
+	const (
+		permit = `permit (principal, action == DocumentManagement::Action::"ViewDocument", resource);`
+		forbid = `forbid (principal == DocumentManagement::User::"charlie", action, resource);`
+	)
+	// The forbid sits in the first and in the last file read
+	for _, files := range [][2]string{{forbid, permit}, {permit, forbid}} {
+		fsys := fstest.MapFS{
+			"policies/a.cedar": {Data: []byte(files[0])},
+			"policies/b.cedar": {Data: []byte(files[1])},
+		}
+		policySet, err := cedarload.LoadPolicies(fsys, "policies")
+		if err != nil {
+			t.Fatal(err)
+		}
+		slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, doc2EntityData(), "charlie", "doc2", entityLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		view := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), "ViewDocument")
+		allowed, diagnostic, err := checkAuthorization(policySet, slice, view, cedar.RecordMap{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantForbid := "b.cedar/policy0"
+		if files[0] == forbid {
+			wantForbid = "a.cedar/policy0"
+		}
+		if allowed {
+			t.Errorf("%s forbids charlie, but ViewDocument was allowed", wantForbid)
+		}
+		if len(diagnostic.Reasons) != 1 || string(diagnostic.Reasons[0].PolicyID) != wantForbid {
+			t.Errorf("got reasons %v, want only %s", diagnostic.Reasons, wantForbid)
+		}
+	}
+}
+
+// embedded holds the policies and schema the way an application would ship
+// them inside its binary
+//
+//go:embed policies.cedar schema.cedarschema
+var embedded embed.FS
+
+func TestLoadEmbeddedPoliciesAndSchema(t *testing.T) {
+	policySet, err := cedarload.LoadPolicies(embedded, "policies.cedar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cedarSchema, err := cedarload.LoadSchema(embedded, "schema.cedarschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues, err := validatePolicies(cedarSchema, policySet)
+	if err != nil || len(issues) > 0 {
+		t.Fatalf("embedded policies don't validate: %v %v", issues, err)
+	}
+
+	action, _, err := parseDocumentAction(cedarSchema, "view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, doc2EntityData(), "charlie", "doc2", entityLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, _, err := checkAuthorization(policySet, slice, cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), cedar.String(action)), cedar.RecordMap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Error("charlie can't view doc2 with the embedded policies")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"simple-cedar-check/cedarload"
+)
+
+// runPolicyCheck implements "cedar-check policy check": it parses the policy
+// file with the compiled cedar-go and, with --against-version, flags the
+// constructs that the given cedar-go release can't parse. It returns false
+// when the policies have problems.
+func runPolicyCheck(fsys fs.FS, args []string) (bool, error) {
+	flags := flag.NewFlagSet("policy check", flag.ContinueOnError)
+	against := flags.String("against-version", "", "cedar-go release to check the policies against, e.g. v1.1.0")
+	if err := flags.Parse(args); err != nil {
+		return false, err
+	}
+	name := "policies.cedar"
+	if flags.NArg() > 0 {
+		name = flags.Arg(0)
+	}
+
+	var target [3]int
+	if *against != "" {
+		var ok bool
+		if target, ok = cedarload.ParseVersion(*against); !ok {
+			return false, fmt.Errorf("invalid --against-version %q, expected vMAJOR.MINOR.PATCH", *against)
+		}
+	}
+
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policies: %w", err)
+	}
+
+	clean := true
+	if _, err := cedarload.ReadPolicySet(name, strings.NewReader(string(src))); err != nil {
+		var parseErr *cedarload.PolicyParseError
+		if !errors.As(err, &parseErr) {
+			return false, err
+		}
+		fmt.Fprintf(os.Stderr, "❌ %v\n", parseErr)
+		clean = false
+	}
+
+	if *against != "" {
+		for i, line := range strings.Split(string(src), "\n") {
+			for _, finding := range cedarload.FindGatedConstructs(line) {
+				required, ok := cedarload.ParseVersion(finding.MinVersion)
+				if ok && cedarload.CompareVersions(target, required) >= 0 {
+					continue
+				}
+				needs := "is not supported by cedar-go"
+				if ok {
+					needs = "requires cedar-go " + finding.MinVersion
+				}
+				fmt.Printf("⚠️  %s:%d:%d: %s %s (checking against %s)\n",
+					name, i+1, finding.Column, finding.Construct, needs, *against)
+				clean = false
+			}
+		}
+	}
+
+	if clean {
+		fmt.Printf("✅ %s parses with cedar-go %s\n", name, cedarload.CompiledCedarGoVersion())
+		if *against != "" {
+			fmt.Printf("✅ %s uses no constructs newer than cedar-go %s\n", name, *against)
+		}
+	}
+	return clean, nil
+}
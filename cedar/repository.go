@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// queryGuards bound the cost of a single entity query
+type queryGuards struct {
+	// StatementTimeout is applied as the Postgres statement_timeout (0 disables it)
+	StatementTimeout time.Duration
+	// MaxRows aborts the query with ErrEntitySliceTooLarge when the permission
+	// rows exceed it (0 disables it)
+	MaxRows int
+	// MaxFolderDepth is how many levels of parent folders are walked above
+	// the document's folder; it also stops the walk on a parent_folder_id cycle
+	MaxFolderDepth int
+}
+
+// ErrDocumentNotFound is returned when the document of a check doesn't
+// exist, which would otherwise be denied like a missing permission
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrUserNotInOrganization is returned by --strict checks of a user who
+// belongs to no organization, e.g. a mistyped user ID
+var ErrUserNotInOrganization = errors.New("user belongs to no organization")
+
+// requireOrganization returns ErrUserNotInOrganization for userID when its
+// organization is empty
+func requireOrganization(organization, userID string) error {
+	if organization == "" {
+		return fmt.Errorf("%w: %s", ErrUserNotInOrganization, userID)
+	}
+	return nil
+}
+
+// EntityRepository loads the data the Cedar entities of a check are built
+// from. cedar-check reads it from Postgres; fakes can drive checks without a
+// database. GetEntityData returns ErrDocumentNotFound for unknown documents;
+// GetEntityDataBatch loads many documents at once, keyed by document ID, and
+// leaves unknown documents out.
+type EntityRepository interface {
+	GetEntityData(ctx context.Context, userID, documentID string) (*cedarauthz.EntityData, error)
+	GetEntityDataBatch(ctx context.Context, userID string, documentIDs []string) (map[string]*cedarauthz.EntityData, error)
+}
+
+// postgresRepository is the EntityRepository backed by schema.sql
+type postgresRepository struct {
+	db     *sql.DB
+	guards queryGuards
+}
+
+// GetEntityData retrieves all entity data needed for Cedar authorization
+func (r *postgresRepository) GetEntityData(ctx context.Context, userID, documentID string) (*cedarauthz.EntityData, error) {
+	query := `
+	WITH RECURSIVE doc_info AS (
+		SELECT d.id as doc_id, d.organization_id as doc_org_id, 
+			   d.folder_id, d.owner_id as doc_owner_id, d.is_public,
+			   f.organization_id as folder_org_id, f.owner_id as folder_owner_id,
+			   f.workspace_id, w.organization_id as workspace_org_id
+		FROM documents d
+		LEFT JOIN folders f ON d.folder_id = f.id
+		LEFT JOIN workspaces w ON f.workspace_id = w.id
+		WHERE d.id = $2
+	),
+	-- The document's folder (depth 0) and its ancestors
+	folder_chain AS (
+		SELECT f.id, f.organization_id, f.owner_id, f.workspace_id, f.parent_folder_id, 0 as depth
+		FROM folders f
+		JOIN doc_info di ON f.id = di.folder_id
+		UNION ALL
+		SELECT p.id, p.organization_id, p.owner_id, p.workspace_id, p.parent_folder_id, fc.depth + 1
+		FROM folders p
+		JOIN folder_chain fc ON p.id = fc.parent_folder_id
+		WHERE fc.depth < $4
+	),
+	doc_perms AS (
+		SELECT dp.document_id, dp.user_id, dp.permission_type, 'document' as resource_type
+		FROM document_permissions dp
+		WHERE dp.document_id = $2
+	),
+	-- Permissions on any folder of the chain apply to the document's folder.
+	-- Owners and workspace admins of ancestors are editors of the folders
+	-- nested inside them, like the direct folder's are.
+	folder_perms AS (
+		SELECT fp.folder_id as document_id, fp.user_id, fp.permission_type, 'folder' as resource_type
+		FROM folder_permissions fp
+		JOIN folder_chain fc ON fp.folder_id = fc.id
+		UNION ALL
+		SELECT fc.id, fc.owner_id, 'editor', 'folder'
+		FROM folder_chain fc
+		WHERE fc.depth > 0 AND fc.owner_id IS NOT NULL
+		UNION ALL
+		SELECT fc.id, wp.user_id, 'editor', 'folder'
+		FROM folder_chain fc
+		JOIN workspace_permissions wp ON wp.workspace_id = fc.workspace_id
+		WHERE fc.depth > 0
+	),
+	doc_group_perms AS (
+		SELECT gp.document_id, gp.group_id as user_id, gp.permission_type, 'document_group' as resource_type
+		FROM document_group_permissions gp
+		WHERE gp.document_id = $2
+	),
+	folder_group_perms AS (
+		SELECT gp.folder_id as document_id, gp.group_id as user_id, gp.permission_type, 'folder_group' as resource_type
+		FROM folder_group_permissions gp
+		JOIN folder_chain fc ON gp.folder_id = fc.id
+	),
+	workspace_perms AS (
+		SELECT wp.workspace_id as document_id, wp.user_id, wp.permission_type, 'workspace' as resource_type
+		FROM workspace_permissions wp
+		JOIN doc_info di ON wp.workspace_id = di.workspace_id
+		WHERE di.workspace_id IS NOT NULL
+	)
+	SELECT 
+		uo.user_org_id,
+		COALESCE(uo.user_is_admin, false) as user_is_admin,
+		di.doc_id,
+		di.doc_org_id,
+		di.folder_id,
+		di.doc_owner_id,
+		di.is_public,
+		di.folder_org_id,
+		di.folder_owner_id,
+		di.workspace_id,
+		di.workspace_org_id,
+		ARRAY(SELECT id FROM folder_chain WHERE depth > 0 ORDER BY depth) as ancestor_ids,
+		ARRAY(SELECT organization_id FROM folder_chain WHERE depth > 0 ORDER BY depth) as ancestor_org_ids,
+		ARRAY(SELECT group_id FROM group_members WHERE user_id = $1 ORDER BY group_id) as user_group_ids,
+		COALESCE(dp.user_id, '') as perm_user_id,
+		COALESCE(dp.permission_type, '') as perm_type,
+		COALESCE(dp.resource_type, '') as resource_type,
+		ep.expires_at as perm_expires_at
+	FROM doc_info di
+	-- LEFT JOIN so principals with no membership row keep the document data.
+	-- Users have a single organization in Cedar: a member of several gets
+	-- the document's, or else the first by ID.
+	LEFT JOIN LATERAL (
+		SELECT organization_id as user_org_id, is_admin as user_is_admin
+		FROM organization_members
+		WHERE user_id = $1
+		ORDER BY organization_id = di.doc_org_id DESC, organization_id
+		LIMIT 1
+	) uo ON true
+	LEFT JOIN (
+		SELECT * FROM doc_perms
+		UNION ALL
+		SELECT * FROM folder_perms
+		UNION ALL
+		SELECT * FROM workspace_perms
+		UNION ALL
+		SELECT * FROM doc_group_perms
+		UNION ALL
+		SELECT * FROM folder_group_perms
+	) dp ON true
+	-- Expiry of time-bounded document grants; NULL for every other row
+	LEFT JOIN document_permissions ep ON dp.resource_type = 'document'
+		AND ep.document_id = $2 AND ep.user_id = dp.user_id AND ep.permission_type = dp.permission_type
+	ORDER BY resource_type, perm_type, perm_user_id
+	LIMIT $3
+	`
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, userID, documentID, r.rowLimit(), r.guards.MaxFolderDepth)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	data := newEntityData()
+	rowCount := 0
+	for rows.Next() {
+		// Stop before scanning past the cap rather than materializing everything
+		rowCount++
+		if r.guards.MaxRows > 0 && rowCount > r.guards.MaxRows {
+			return nil, fmt.Errorf("%w: document %s returned more than %d permission rows",
+				ErrEntitySliceTooLarge, documentID, r.guards.MaxRows)
+		}
+		row, err := scanEntityRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		row.addTo(data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration failed: %w", err)
+	}
+	// doc_info drives the query, so no rows means no document
+	if data.DocumentID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, documentID)
+	}
+
+	return data, nil
+}
+
+// entityDataBatchQuery is the query of GetEntityData for the documents in
+// $2. Every CTE carries the doc_id it was reached from, the folder chain is
+// walked per document, and $3 caps the permission rows of each document
+// rather than of the whole result.
+const entityDataBatchQuery = `
+WITH RECURSIVE doc_info AS (
+	SELECT d.id as doc_id, d.organization_id as doc_org_id,
+		   d.folder_id, d.owner_id as doc_owner_id, d.is_public,
+		   f.organization_id as folder_org_id, f.owner_id as folder_owner_id,
+		   f.workspace_id, w.organization_id as workspace_org_id
+	FROM documents d
+	LEFT JOIN folders f ON d.folder_id = f.id
+	LEFT JOIN workspaces w ON f.workspace_id = w.id
+	WHERE d.id = ANY($2)
+),
+folder_chain AS (
+	SELECT di.doc_id, f.id, f.organization_id, f.owner_id, f.workspace_id, f.parent_folder_id, 0 as depth
+	FROM folders f
+	JOIN doc_info di ON f.id = di.folder_id
+	UNION ALL
+	SELECT fc.doc_id, p.id, p.organization_id, p.owner_id, p.workspace_id, p.parent_folder_id, fc.depth + 1
+	FROM folders p
+	JOIN folder_chain fc ON p.id = fc.parent_folder_id
+	WHERE fc.depth < $4
+),
+perms AS (
+	SELECT all_perms.*,
+		ROW_NUMBER() OVER (PARTITION BY doc_id ORDER BY resource_type, permission_type, user_id) as perm_row
+	FROM (
+		SELECT dp.document_id as doc_id, dp.user_id, dp.permission_type, 'document' as resource_type
+		FROM document_permissions dp
+		WHERE dp.document_id = ANY($2)
+		UNION ALL
+		SELECT fc.doc_id, fp.user_id, fp.permission_type, 'folder'
+		FROM folder_permissions fp
+		JOIN folder_chain fc ON fp.folder_id = fc.id
+		UNION ALL
+		SELECT fc.doc_id, fc.owner_id, 'editor', 'folder'
+		FROM folder_chain fc
+		WHERE fc.depth > 0 AND fc.owner_id IS NOT NULL
+		UNION ALL
+		SELECT fc.doc_id, wp.user_id, 'editor', 'folder'
+		FROM folder_chain fc
+		JOIN workspace_permissions wp ON wp.workspace_id = fc.workspace_id
+		WHERE fc.depth > 0
+		UNION ALL
+		SELECT di.doc_id, wp.user_id, wp.permission_type, 'workspace'
+		FROM workspace_permissions wp
+		JOIN doc_info di ON wp.workspace_id = di.workspace_id
+		UNION ALL
+		SELECT gp.document_id, gp.group_id, gp.permission_type, 'document_group'
+		FROM document_group_permissions gp
+		WHERE gp.document_id = ANY($2)
+		UNION ALL
+		SELECT fc.doc_id, gp.group_id, gp.permission_type, 'folder_group'
+		FROM folder_group_permissions gp
+		JOIN folder_chain fc ON gp.folder_id = fc.id
+	) all_perms
+)
+SELECT
+	uo.user_org_id,
+	COALESCE(uo.user_is_admin, false) as user_is_admin,
+	di.doc_id,
+	di.doc_org_id,
+	di.folder_id,
+	di.doc_owner_id,
+	di.is_public,
+	di.folder_org_id,
+	di.folder_owner_id,
+	di.workspace_id,
+	di.workspace_org_id,
+	ARRAY(SELECT id FROM folder_chain fc WHERE fc.doc_id = di.doc_id AND depth > 0 ORDER BY depth) as ancestor_ids,
+	ARRAY(SELECT organization_id FROM folder_chain fc WHERE fc.doc_id = di.doc_id AND depth > 0 ORDER BY depth) as ancestor_org_ids,
+	ARRAY(SELECT group_id FROM group_members WHERE user_id = $1 ORDER BY group_id) as user_group_ids,
+	COALESCE(p.user_id, '') as perm_user_id,
+	COALESCE(p.permission_type, '') as perm_type,
+	COALESCE(p.resource_type, '') as resource_type,
+	ep.expires_at as perm_expires_at
+FROM doc_info di
+-- The organization of the user is picked per document, as in GetEntityData
+LEFT JOIN LATERAL (
+	SELECT organization_id as user_org_id, is_admin as user_is_admin
+	FROM organization_members
+	WHERE user_id = $1
+	ORDER BY organization_id = di.doc_org_id DESC, organization_id
+	LIMIT 1
+) uo ON true
+LEFT JOIN perms p ON p.doc_id = di.doc_id AND ($3::bigint IS NULL OR p.perm_row <= $3)
+LEFT JOIN document_permissions ep ON p.resource_type = 'document'
+	AND ep.document_id = di.doc_id AND ep.user_id = p.user_id AND ep.permission_type = p.permission_type
+ORDER BY di.doc_id, resource_type, perm_type, perm_user_id
+`
+
+// GetEntityDataBatch retrieves the entity data of every document in
+// documentIDs with a single query, applying the guards of GetEntityData to
+// each document. Unknown documents are left out of the result.
+func (r *postgresRepository) GetEntityDataBatch(ctx context.Context, userID string, documentIDs []string) (map[string]*cedarauthz.EntityData, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, entityDataBatchQuery, userID, pq.Array(documentIDs), r.rowLimit(), r.guards.MaxFolderDepth)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]*cedarauthz.EntityData, len(documentIDs))
+	rowCounts := make(map[string]int, len(documentIDs))
+	for rows.Next() {
+		row, err := scanEntityRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		documentID := row.docID.String
+		rowCounts[documentID]++
+		if r.guards.MaxRows > 0 && rowCounts[documentID] > r.guards.MaxRows {
+			return nil, fmt.Errorf("%w: document %s returned more than %d permission rows",
+				ErrEntitySliceTooLarge, documentID, r.guards.MaxRows)
+		}
+		data, ok := result[documentID]
+		if !ok {
+			data = newEntityData()
+			result[documentID] = data
+		}
+		row.addTo(data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration failed: %w", err)
+	}
+	return result, nil
+}
+
+// begin starts the read-only transaction of an entity query, with the
+// statement timeout of the guards
+func (r *postgresRepository) begin(ctx context.Context) (*sql.Tx, error) {
+	// statement_timeout can only be scoped with SET LOCAL inside a transaction
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	if r.guards.StatementTimeout > 0 {
+		timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", r.guards.StatementTimeout.Milliseconds())
+		if _, err := tx.ExecContext(ctx, timeout); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("setting statement timeout failed: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// rowLimit is the LIMIT of the permission rows: one row past the cap, so
+// exceeding it can be detected. LIMIT NULL means no limit.
+func (r *postgresRepository) rowLimit() sql.NullInt64 {
+	if r.guards.MaxRows > 0 {
+		return sql.NullInt64{Int64: int64(r.guards.MaxRows) + 1, Valid: true}
+	}
+	return sql.NullInt64{}
+}
+
+func newEntityData() *cedarauthz.EntityData {
+	return &cedarauthz.EntityData{
+		DocumentPermissions:  make(map[string][]string),
+		DocumentExpirations:  make(map[cedarauthz.DocumentGrant]time.Time),
+		FolderPermissions:    make(map[string][]string),
+		WorkspacePermissions: make(map[string][]string),
+
+		DocumentGroupPermissions: make(map[string][]string),
+		FolderGroupPermissions:   make(map[string][]string),
+	}
+}
+
+// entityRow is a row of the entity queries: the principal and the document,
+// repeated on every row, and one permission
+type entityRow struct {
+	userOrg, docID, docOrg, folderID, docOwner, folderOrg, folderOwner sql.NullString
+	workspaceID, workspaceOrg                                          sql.NullString
+	ancestorIDs, ancestorOrgs, userGroups                              pq.StringArray
+	userIsAdmin, docPublic                                             bool
+	permUserID, permType, resourceType                                 string
+	permExpiresAt                                                      sql.NullTime
+}
+
+func scanEntityRow(rows *sql.Rows) (*entityRow, error) {
+	var row entityRow
+	err := rows.Scan(&row.userOrg, &row.userIsAdmin, &row.docID, &row.docOrg, &row.folderID, &row.docOwner,
+		&row.docPublic, &row.folderOrg, &row.folderOwner, &row.workspaceID, &row.workspaceOrg,
+		&row.ancestorIDs, &row.ancestorOrgs, &row.userGroups, &row.permUserID, &row.permType, &row.resourceType, &row.permExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	return &row, nil
+}
+
+// addTo adds the row to data: the principal and document on the first row,
+// and the permission of every row
+func (row *entityRow) addTo(data *cedarauthz.EntityData) {
+	// Set basic entity data (only on first row)
+	if data.DocumentID == "" {
+		data.UserOrganization = row.userOrg.String
+		data.UserIsAdmin = row.userIsAdmin
+		data.DocumentID = row.docID.String
+		data.DocumentOrg = row.docOrg.String
+		data.DocumentPublic = row.docPublic
+		if row.folderID.Valid {
+			data.FolderID = &row.folderID.String
+		}
+		if row.docOwner.Valid {
+			data.DocumentOwner = &row.docOwner.String
+		}
+		if row.folderOrg.Valid {
+			data.FolderOrg = &row.folderOrg.String
+		}
+		if row.folderOwner.Valid {
+			data.FolderOwner = &row.folderOwner.String
+		}
+		if row.workspaceID.Valid {
+			data.WorkspaceID = &row.workspaceID.String
+		}
+		if row.workspaceOrg.Valid {
+			data.WorkspaceOrg = &row.workspaceOrg.String
+		}
+		for i, id := range row.ancestorIDs {
+			data.FolderAncestors = append(data.FolderAncestors, cedarauthz.FolderAncestor{ID: id, Organization: row.ancestorOrgs[i]})
+		}
+		data.UserGroups = row.userGroups
+	}
+
+	// Process permissions
+	if row.permUserID == "" || row.permType == "" {
+		return
+	}
+	permType, permUserID := row.permType, row.permUserID
+	if row.resourceType == "document" {
+		data.DocumentPermissions[permType] = appendUnique(
+			data.DocumentPermissions[permType], permUserID)
+		if row.permExpiresAt.Valid {
+			data.DocumentExpirations[cedarauthz.DocumentGrant{PermissionType: permType, UserID: permUserID}] = row.permExpiresAt.Time
+		}
+	} else if row.resourceType == "folder" {
+		data.FolderPermissions[permType] = appendUnique(
+			data.FolderPermissions[permType], permUserID)
+	} else if row.resourceType == "workspace" {
+		data.WorkspacePermissions[permType] = appendUnique(
+			data.WorkspacePermissions[permType], permUserID)
+	} else if row.resourceType == "document_group" {
+		data.DocumentGroupPermissions[permType] = appendUnique(
+			data.DocumentGroupPermissions[permType], permUserID)
+	} else if row.resourceType == "folder_group" {
+		data.FolderGroupPermissions[permType] = appendUnique(
+			data.FolderGroupPermissions[permType], permUserID)
+	}
+}
+
+// appendUnique appends userID to userIDs unless it is already present, so
+// repeated permission rows don't produce duplicate members in Cedar sets
+func appendUnique(userIDs []string, userID string) []string {
+	for _, id := range userIDs {
+		if id == userID {
+			return userIDs
+		}
+	}
+	return append(userIDs, userID)
+}
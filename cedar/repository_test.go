@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"simple-cedar-check/cedarauthz"
+)
+
+// entityColumns are the columns GetEntityData scans, in order
+var entityColumns = []string{
+	"user_org_id", "user_is_admin", "doc_id", "doc_org_id", "folder_id", "doc_owner_id",
+	"is_public", "folder_org_id", "folder_owner_id", "workspace_id", "workspace_org_id",
+	"ancestor_ids", "ancestor_org_ids", "user_group_ids",
+	"perm_user_id", "perm_type", "resource_type", "perm_expires_at",
+}
+
+// doc2Row returns a row of the entity query for charlie and doc2 carrying
+// one permission
+func doc2Row(permUserID, permType, resourceType string) []driver.Value {
+	return []driver.Value{
+		"org1", false, "doc2", "org1", "folder1", "bob",
+		false, "org1", "alice", "ws1", "org1",
+		"{}", "{}", "{}",
+		permUserID, permType, resourceType, nil,
+	}
+}
+
+// newMockRepository returns a postgresRepository on a sqlmock database
+// expecting the read-only transaction of one GetEntityData call
+func newMockRepository(t *testing.T, guards queryGuards) (*postgresRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.ExpectBegin()
+	return &postgresRepository{db: db, guards: guards}, mock
+}
+
+func TestGetEntityDataMaxPermissionRows(t *testing.T) {
+	repo, mock := newMockRepository(t, queryGuards{MaxRows: 2})
+	rows := sqlmock.NewRows(entityColumns).
+		AddRow(doc2Row("charlie", "viewer", "document")...).
+		AddRow(doc2Row("eve", "editor", "document")...).
+		AddRow(doc2Row("bob", "viewer", "folder")...)
+	// LIMIT is one past the cap so exceeding it is detectable
+	mock.ExpectQuery("WITH RECURSIVE").WithArgs("charlie", "doc2", int64(3), 0).WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	_, err := repo.GetEntityData(context.Background(), "charlie", "doc2")
+	if !errors.Is(err, ErrEntitySliceTooLarge) {
+		t.Fatalf("got error %v, want ErrEntitySliceTooLarge", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetEntityDataUnderMaxPermissionRows(t *testing.T) {
+	repo, mock := newMockRepository(t, queryGuards{MaxRows: 2})
+	rows := sqlmock.NewRows(entityColumns).
+		AddRow(doc2Row("charlie", "viewer", "document")...).
+		AddRow(doc2Row("eve", "editor", "document")...)
+	mock.ExpectQuery("WITH RECURSIVE").WithArgs("charlie", "doc2", int64(3), 0).WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	data, err := repo.GetEntityData(context.Background(), "charlie", "doc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.DocumentPermissions) != 2 {
+		t.Errorf("got document permissions %v, want an editor and a viewer", data.DocumentPermissions)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetEntityDataRows(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	doc3 := []driver.Value{
+		"org1", false, "doc3", "org2", nil, "david",
+		false, nil, nil, nil, nil,
+		"{}", "{}", "{}",
+		"", "", "", nil,
+	}
+	unowned := doc2Row("", "", "")
+	unowned[5] = nil
+	expiresAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	nested := doc2Row("charlie", "viewer", "document")
+	nested[11], nested[12], nested[13] = "{root_folder_org1}", "{org1}", "{eng}"
+	expiring := slices.Clone(nested)
+	expiring[14], expiring[15], expiring[17] = "david", "viewer", expiresAt
+
+	tests := []struct {
+		name string
+		rows [][]driver.Value
+		want func(data *cedarauthz.EntityData)
+	}{
+		{
+			name: "no folder",
+			rows: [][]driver.Value{doc3},
+			want: func(data *cedarauthz.EntityData) {
+				data.UserOrganization = "org1"
+				data.DocumentID, data.DocumentOrg = "doc3", "org2"
+				data.DocumentOwner = ptr("david")
+				data.UserGroups = []string{}
+			},
+		},
+		{
+			name: "folder without permissions",
+			rows: [][]driver.Value{doc2Row("", "", "")},
+			want: func(data *cedarauthz.EntityData) {
+				setDoc2(data, ptr)
+			},
+		},
+		{
+			name: "NULL owner",
+			rows: [][]driver.Value{unowned},
+			want: func(data *cedarauthz.EntityData) {
+				setDoc2(data, ptr)
+				data.DocumentOwner = nil
+			},
+		},
+		{
+			name: "multiple rows",
+			rows: [][]driver.Value{
+				nested,
+				nested, // repeated through two paths
+				expiring,
+				slices.Concat(nested[:14], []driver.Value{"bob", "editor", "folder", nil}),
+				slices.Concat(nested[:14], []driver.Value{"grace", "admin", "workspace", nil}),
+				slices.Concat(nested[:14], []driver.Value{"eng", "viewer", "document_group", nil}),
+				slices.Concat(nested[:14], []driver.Value{"ops", "editor", "folder_group", nil}),
+			},
+			want: func(data *cedarauthz.EntityData) {
+				setDoc2(data, ptr)
+				data.UserGroups = []string{"eng"}
+				data.FolderAncestors = []cedarauthz.FolderAncestor{{ID: "root_folder_org1", Organization: "org1"}}
+				data.DocumentPermissions["viewer"] = []string{"charlie", "david"}
+				data.DocumentExpirations[cedarauthz.DocumentGrant{PermissionType: "viewer", UserID: "david"}] = expiresAt
+				data.FolderPermissions["editor"] = []string{"bob"}
+				data.WorkspacePermissions["admin"] = []string{"grace"}
+				data.DocumentGroupPermissions["viewer"] = []string{"eng"}
+				data.FolderGroupPermissions["editor"] = []string{"ops"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepository(t, queryGuards{})
+			rows := sqlmock.NewRows(entityColumns)
+			for _, row := range tt.rows {
+				rows.AddRow(row...)
+			}
+			mock.ExpectQuery("WITH RECURSIVE").WithArgs("charlie", "doc", nil, 0).WillReturnRows(rows)
+			mock.ExpectRollback()
+
+			got, err := repo.GetEntityData(context.Background(), "charlie", "doc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := newEntityData()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// The rows Postgres returns for documents of schema.sql fold into the entity
+// data of the fixture the decision tests use
+func TestGetEntityDataFixtureDocument(t *testing.T) {
+	// frank is a member of org2 and of the apollo group
+	frank := []driver.Value{"org2", false}
+	tests := []struct {
+		documentID string
+		document   []driver.Value
+		perms      [][]driver.Value
+	}{
+		{
+			documentID: "doc4",
+			document:   []driver.Value{"doc4", "org1", "root_folder_org1", "alice", false, "org1", "alice", nil, nil, "{}", "{}"},
+			perms: [][]driver.Value{
+				{"bob", "editor", "document", nil},
+				{"charlie", "viewer", "document", nil},
+				{"david", "viewer", "document", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			// Grants and owners of folder4 and folder3 apply to folder5; alice
+			// owns both ancestors
+			documentID: "doc6",
+			document:   []driver.Value{"doc6", "org1", "folder5", "alice", false, "org1", "alice", nil, nil, "{folder4,folder3}", "{org1,org1}"},
+			perms: [][]driver.Value{
+				{"eve", "viewer", "folder", nil},
+				{"alice", "editor", "folder", nil},
+				{"alice", "editor", "folder", nil},
+				{"apollo", "editor", "folder_group", nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.documentID, func(t *testing.T) {
+			repo, mock := newMockRepository(t, queryGuards{})
+			rows := sqlmock.NewRows(entityColumns)
+			for _, perm := range tt.perms {
+				rows.AddRow(slices.Concat(frank, tt.document, []driver.Value{"{apollo}"}, perm)...)
+			}
+			mock.ExpectQuery("WITH RECURSIVE").WithArgs("frank", tt.documentID, nil, 0).WillReturnRows(rows)
+			mock.ExpectRollback()
+
+			got, err := repo.GetEntityData(context.Background(), "frank", tt.documentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fixtureEntityData("frank", tt.documentID); !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGetEntityDataMissingDocument(t *testing.T) {
+	repo, mock := newMockRepository(t, queryGuards{})
+	mock.ExpectQuery("WITH RECURSIVE").WithArgs("charlie", "doc9", nil, 0).
+		WillReturnRows(sqlmock.NewRows(entityColumns))
+	mock.ExpectRollback()
+
+	_, err := repo.GetEntityData(context.Background(), "charlie", "doc9")
+	if !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("got error %v, want ErrDocumentNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A member of two organizations gets the organization of each document, so
+// both queries must order the memberships rather than take any one of them
+func TestGetEntityDataUserInTwoOrganizations(t *testing.T) {
+	const pickOrganization = `ORDER BY organization_id = di\.doc_org_id DESC, organization_id\s+LIMIT 1`
+	// zoe is an admin of org1 and a member of org2; doc3 is in org2
+	doc2 := doc2Row("", "", "")
+	doc2[0], doc2[1] = "org1", true
+	doc3 := doc2Row("", "", "")
+	doc3[0], doc3[1], doc3[2], doc3[3] = "org2", false, "doc3", "org2"
+
+	t.Run("single document", func(t *testing.T) {
+		repo, mock := newMockRepository(t, queryGuards{})
+		mock.ExpectQuery("WITH RECURSIVE(.|\n)*"+pickOrganization).WithArgs("zoe", "doc3", nil, 0).
+			WillReturnRows(sqlmock.NewRows(entityColumns).AddRow(doc3...))
+		mock.ExpectRollback()
+
+		data, err := repo.GetEntityData(context.Background(), "zoe", "doc3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.UserOrganization != "org2" || data.UserIsAdmin {
+			t.Errorf("got organization %s (admin %v), want org2 (admin false)", data.UserOrganization, data.UserIsAdmin)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		repo, mock := newMockRepository(t, queryGuards{})
+		mock.ExpectQuery("WHERE d.id = ANY(.|\n)*"+pickOrganization).WithArgs("zoe", sqlmock.AnyArg(), nil, 0).
+			WillReturnRows(sqlmock.NewRows(entityColumns).AddRow(doc2...).AddRow(doc3...))
+		mock.ExpectRollback()
+
+		batch, err := repo.GetEntityDataBatch(context.Background(), "zoe", []string{"doc2", "doc3"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := batch["doc2"]; got == nil || got.UserOrganization != "org1" || !got.UserIsAdmin {
+			t.Errorf("doc2: got %+v, want zoe as an admin of org1", got)
+		}
+		if got := batch["doc3"]; got == nil || got.UserOrganization != "org2" || got.UserIsAdmin {
+			t.Errorf("doc3: got %+v, want zoe as a member of org2", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// setDoc2 sets the principal and document fields of doc2Row on data
+func setDoc2(data *cedarauthz.EntityData, ptr func(string) *string) {
+	data.UserOrganization = "org1"
+	data.DocumentID, data.DocumentOrg = "doc2", "org1"
+	data.FolderID, data.DocumentOwner = ptr("folder1"), ptr("bob")
+	data.FolderOrg, data.FolderOwner = ptr("org1"), ptr("alice")
+	data.WorkspaceID, data.WorkspaceOrg = ptr("ws1"), ptr("org1")
+	data.UserGroups = []string{}
+}
@@ -2,11 +2,17 @@
 -- This script creates all the tables and data needed for the blog post example
 
 -- Drop tables if they exist (for clean setup)
+DROP TABLE IF EXISTS folder_group_permissions;
+DROP TABLE IF EXISTS document_group_permissions;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS workspace_permissions;
 DROP TABLE IF EXISTS folder_permissions;
 DROP TABLE IF EXISTS document_permissions;
 DROP TABLE IF EXISTS organization_members;
 DROP TABLE IF EXISTS documents;
 DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS workspaces;
 DROP TABLE IF EXISTS users;
 DROP TABLE IF EXISTS organizations;
 
@@ -23,12 +29,21 @@ CREATE TABLE users (
     email VARCHAR(100)
 );
 
+-- Create Workspaces table (organization -> workspace -> folder -> document)
+CREATE TABLE workspaces (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    organization_id VARCHAR(50) NOT NULL REFERENCES organizations(id)
+);
+
 -- Create Folders table
 CREATE TABLE folders (
     id VARCHAR(50) PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     organization_id VARCHAR(50) NOT NULL REFERENCES organizations(id),
-    owner_id VARCHAR(50) REFERENCES users(id)
+    owner_id VARCHAR(50) REFERENCES users(id),
+    workspace_id VARCHAR(50) REFERENCES workspaces(id),
+    parent_folder_id VARCHAR(50) REFERENCES folders(id)
 );
 
 -- Create Documents table
@@ -37,13 +52,17 @@ CREATE TABLE documents (
     name VARCHAR(100) NOT NULL,
     organization_id VARCHAR(50) NOT NULL REFERENCES organizations(id),
     owner_id VARCHAR(50) REFERENCES users(id),
-    folder_id VARCHAR(50) REFERENCES folders(id)
+    folder_id VARCHAR(50) REFERENCES folders(id),
+    -- Public documents can be viewed by anyone, like an anyone-with-the-link share
+    is_public BOOLEAN NOT NULL DEFAULT false
 );
 
 -- Create Organization Members table (many-to-many relationship)
 CREATE TABLE organization_members (
     user_id VARCHAR(50) NOT NULL REFERENCES users(id),
     organization_id VARCHAR(50) NOT NULL REFERENCES organizations(id),
+    -- Organization admins can view, edit and share everything in the organization
+    is_admin BOOLEAN NOT NULL DEFAULT false,
     PRIMARY KEY (user_id, organization_id)
 );
 
@@ -53,6 +72,8 @@ CREATE TABLE document_permissions (
     document_id VARCHAR(50) NOT NULL REFERENCES documents(id),
     user_id VARCHAR(50) NOT NULL REFERENCES users(id),
     permission_type VARCHAR(20) NOT NULL CHECK (permission_type IN ('viewer', 'editor')),
+    -- Time-bounded shares stop applying at expires_at; NULL never expires
+    expires_at TIMESTAMPTZ,
     UNIQUE(document_id, user_id, permission_type)
 );
 
@@ -65,6 +86,46 @@ CREATE TABLE folder_permissions (
     UNIQUE(folder_id, user_id, permission_type)
 );
 
+-- Create Workspace Permissions table (admins can edit everything inside the workspace)
+CREATE TABLE workspace_permissions (
+    id SERIAL PRIMARY KEY,
+    workspace_id VARCHAR(50) NOT NULL REFERENCES workspaces(id),
+    user_id VARCHAR(50) NOT NULL REFERENCES users(id),
+    permission_type VARCHAR(20) NOT NULL CHECK (permission_type IN ('admin')),
+    UNIQUE(workspace_id, user_id, permission_type)
+);
+
+-- Create Groups table (teams of users that can be granted access together)
+CREATE TABLE groups (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+-- Create Group Members table
+CREATE TABLE group_members (
+    group_id VARCHAR(50) NOT NULL REFERENCES groups(id),
+    user_id VARCHAR(50) NOT NULL REFERENCES users(id),
+    PRIMARY KEY (group_id, user_id)
+);
+
+-- Create Document Group Permissions table (granted to every member of the group)
+CREATE TABLE document_group_permissions (
+    id SERIAL PRIMARY KEY,
+    document_id VARCHAR(50) NOT NULL REFERENCES documents(id),
+    group_id VARCHAR(50) NOT NULL REFERENCES groups(id),
+    permission_type VARCHAR(20) NOT NULL CHECK (permission_type IN ('viewer', 'editor')),
+    UNIQUE(document_id, group_id, permission_type)
+);
+
+-- Create Folder Group Permissions table (granted to every member of the group)
+CREATE TABLE folder_group_permissions (
+    id SERIAL PRIMARY KEY,
+    folder_id VARCHAR(50) NOT NULL REFERENCES folders(id),
+    group_id VARCHAR(50) NOT NULL REFERENCES groups(id),
+    permission_type VARCHAR(20) NOT NULL CHECK (permission_type IN ('viewer', 'editor')),
+    UNIQUE(folder_id, group_id, permission_type)
+);
+
 -- Insert test data
 -- Organizations
 INSERT INTO organizations (id, name) VALUES 
@@ -77,39 +138,85 @@ INSERT INTO users (id, name, email) VALUES
     ('bob', 'Bob Smith', 'bob@techcorp.com'),
     ('charlie', 'Charlie Brown', 'charlie@techcorp.com'),
     ('david', 'David Wilson', 'david@marketing.com'),
-    ('eve', 'Eve Davis', 'eve@marketing.com');
+    ('eve', 'Eve Davis', 'eve@marketing.com'),
+    ('frank', 'Frank Miller', 'frank@marketing.com'),
+    ('grace', 'Grace Lee', 'grace@techcorp.com'),
+    ('henry', 'Henry Adams', 'henry@techcorp.com');
 
 -- Organization memberships
-INSERT INTO organization_members (user_id, organization_id) VALUES 
-    ('alice', 'org1'),
-    ('bob', 'org1'),
-    ('charlie', 'org1'),
-    ('david', 'org2'),
-    ('eve', 'org2');
+INSERT INTO organization_members (user_id, organization_id, is_admin) VALUES 
+    ('alice', 'org1', false),
+    ('bob', 'org1', false),
+    ('charlie', 'org1', false),
+    ('david', 'org2', true),
+    ('eve', 'org2', false),
+    ('frank', 'org2', false),
+    ('grace', 'org1', false),
+    ('henry', 'org1', true);
+
+-- Workspaces
+INSERT INTO workspaces (id, name, organization_id) VALUES 
+    ('ws1', 'Engineering', 'org1');
 
 -- Folders
-INSERT INTO folders (id, name, organization_id, owner_id) VALUES 
-    ('folder1', 'Engineering Docs', 'org1', 'alice'),
-    ('folder2', 'Marketing Materials', 'org2', 'david'),
-    ('root_folder_org1', 'Root Folder', 'org1', 'alice');
+INSERT INTO folders (id, name, organization_id, owner_id, workspace_id, parent_folder_id) VALUES 
+    ('folder1', 'Engineering Docs', 'org1', 'alice', 'ws1', NULL),
+    ('folder2', 'Marketing Materials', 'org2', 'david', NULL, NULL),
+    ('root_folder_org1', 'Root Folder', 'org1', 'alice', NULL, NULL),
+    -- Nested folders: folder5 is inside folder4, which is inside folder3
+    ('folder3', 'Projects', 'org1', 'alice', NULL, NULL),
+    ('folder4', 'Project Apollo', 'org1', 'alice', NULL, 'folder3'),
+    ('folder5', 'Apollo Specs', 'org1', 'alice', NULL, 'folder4');
 
 -- Documents
-INSERT INTO documents (id, name, organization_id, owner_id, folder_id) VALUES 
-    ('doc1', 'Architecture Guide', 'org1', 'alice', 'folder1'),
-    ('doc2', 'API Documentation', 'org1', 'bob', 'folder1'),
-    ('doc3', 'Marketing Strategy', 'org2', 'david', 'folder2'),
-    ('doc4', 'Public Document', 'org1', 'alice', 'root_folder_org1');
+INSERT INTO documents (id, name, organization_id, owner_id, folder_id, is_public) VALUES 
+    ('doc1', 'Architecture Guide', 'org1', 'alice', 'folder1', false),
+    ('doc2', 'API Documentation', 'org1', 'bob', 'folder1', false),
+    ('doc3', 'Marketing Strategy', 'org2', 'david', 'folder2', false),
+    ('doc4', 'Public Document', 'org1', 'alice', 'root_folder_org1', false),
+    -- Cross-org ownership: a contractor from org2 owns a document in org1's folder
+    ('doc5', 'Vendor Proposal', 'org1', 'frank', 'folder1', false),
+    -- Nested document: only reachable by eve through the grant on its grandparent folder
+    ('doc6', 'Apollo Design', 'org1', 'alice', 'folder5', false),
+    -- Public document: viewable by anyone, even users with no rows in the database
+    ('doc7', 'Press Kit', 'org2', 'david', 'folder2', true);
 
 -- Document permissions
 INSERT INTO document_permissions (document_id, user_id, permission_type) VALUES 
     ('doc2', 'charlie', 'viewer'),
     ('doc4', 'bob', 'editor'),
-    ('doc4', 'charlie', 'viewer');
+    ('doc4', 'charlie', 'viewer'),
+    -- Editor-only grant: eve has no other path to doc2, so viewing relies on editors implying viewers
+    ('doc2', 'eve', 'editor');
+
+-- Time-bounded share: david could view doc4 until the start of 2026
+INSERT INTO document_permissions (document_id, user_id, permission_type, expires_at) VALUES 
+    ('doc4', 'david', 'viewer', '2026-01-01T00:00:00Z');
 
 -- Folder permissions (these apply to all documents in the folder)
 INSERT INTO folder_permissions (folder_id, user_id, permission_type) VALUES 
     ('folder1', 'bob', 'viewer'),
-    ('folder2', 'eve', 'editor');
+    ('folder2', 'eve', 'editor'),
+    -- Inherited by every folder nested inside folder3
+    ('folder3', 'eve', 'viewer');
+
+-- Workspace permissions (these apply to all folders and documents in the workspace)
+INSERT INTO workspace_permissions (workspace_id, user_id, permission_type) VALUES 
+    ('ws1', 'grace', 'admin');
+
+-- Groups (frank is a contractor on the Apollo team)
+INSERT INTO groups (id, name) VALUES 
+    ('apollo', 'Apollo Team');
+
+INSERT INTO group_members (group_id, user_id) VALUES 
+    ('apollo', 'frank');
+
+-- Group permissions (these apply to every member of the group)
+INSERT INTO document_group_permissions (document_id, group_id, permission_type) VALUES 
+    ('doc2', 'apollo', 'viewer');
+
+INSERT INTO folder_group_permissions (folder_id, group_id, permission_type) VALUES 
+    ('folder4', 'apollo', 'editor');
 
 -- Verify the setup with some sample queries
 SELECT 'Setup verification:' as status;
@@ -118,19 +225,27 @@ SELECT 'Organizations:' as table_name;
 SELECT * FROM organizations;
 
 SELECT 'Users and their organizations:' as info;
-SELECT u.id, u.name, o.name as organization 
+SELECT u.id, u.name, o.name as organization, om.is_admin 
 FROM users u 
 JOIN organization_members om ON u.id = om.user_id 
 JOIN organizations o ON om.organization_id = o.id;
 
 SELECT 'Documents and ownership:' as info;
-SELECT d.id, d.name, d.organization_id, d.owner_id, d.folder_id 
+SELECT d.id, d.name, d.organization_id, d.owner_id, d.folder_id, d.is_public 
 FROM documents d;
 
+SELECT 'Folder hierarchy:' as info;
+SELECT f.id, f.name, f.parent_folder_id 
+FROM folders f;
+
 SELECT 'Document permissions:' as info;
-SELECT dp.document_id, dp.user_id, dp.permission_type 
+SELECT dp.document_id, dp.user_id, dp.permission_type, dp.expires_at 
 FROM document_permissions dp;
 
 SELECT 'Folder permissions:' as info;
 SELECT fp.folder_id, fp.user_id, fp.permission_type 
 FROM folder_permissions fp;
+
+SELECT 'Group members:' as info;
+SELECT gm.group_id, gm.user_id 
+FROM group_members gm;
@@ -34,7 +34,7 @@ echo "📥 Installing Go dependencies..."
 go mod tidy
 
 echo "🔨 Building the application..."
-go build -o cedar-check main.go
+go build -o cedar-check .
 
 echo "✅ Setup complete!"
 echo ""
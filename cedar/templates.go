@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// templateSlotType stands in for the ?principal and ?resource slots while a
+// template is parsed: cedar-go parses static policies only, so each slot is
+// swapped for an entity of this type and replaced again when linking
+const templateSlotType = "TemplateSlot"
+
+// policyTemplate is a template of --templates, linked once per
+// document_permissions row of its permission type
+type policyTemplate struct {
+	Permission string // the @permission annotation, e.g. "viewer"
+	Policy     *cedar.Policy
+}
+
+// loadTemplates parses the templates of name. Every template needs a
+// distinct @permission annotation and must scope principal == ?principal and
+// resource == ?resource. Types written in the DocumentManagement namespace,
+// like the actions of templates.cedar, are moved to namespace, so the
+// templates follow --namespace without being edited.
+func loadTemplates(fsys fs.FS, name string, namespace cedarauthz.Namespace) ([]policyTemplate, error) {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+	prefix := ""
+	if namespace != "" {
+		prefix = string(namespace) + "::"
+	}
+	replacer := strings.NewReplacer(
+		"?principal", templateSlotType+`::"principal"`,
+		"?resource", templateSlotType+`::"resource"`,
+		string(cedarauthz.DefaultNamespace)+"::", prefix,
+	)
+	policySet, err := cedar.NewPolicySetFromBytes(name, []byte(replacer.Replace(string(src))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", cedarload.NewPolicyParseError(name, src, err))
+	}
+
+	// Report problems in source order
+	ids := slices.Collect(maps.Keys(policySet.Map()))
+	slices.SortFunc(ids, func(a, b cedar.PolicyID) int {
+		return policySet.Get(a).Position().Offset - policySet.Get(b).Position().Offset
+	})
+
+	var templates []policyTemplate
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		policy := policySet.Get(id)
+		permission := string(policy.Annotations()["permission"])
+		position := fmt.Sprintf("%s:%d:%d", name, policy.Position().Line, policy.Position().Column)
+		encoded, err := policy.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect template %s: %w", id, err)
+		}
+		var scope struct {
+			Principal jsonScope `json:"principal"`
+			Resource  jsonScope `json:"resource"`
+		}
+		if err := json.Unmarshal(encoded, &scope); err != nil {
+			return nil, fmt.Errorf("failed to inspect template %s: %w", id, err)
+		}
+		switch {
+		case permission == "":
+			return nil, fmt.Errorf("template %s at %s has no @permission annotation", id, position)
+		case seen[permission]:
+			return nil, fmt.Errorf("template %s at %s: permission %q already has a template", id, position, permission)
+		case !scope.Principal.isSlot("principal") || !scope.Resource.isSlot("resource"):
+			return nil, fmt.Errorf("template %s at %s must scope principal == ?principal and resource == ?resource", id, position)
+		}
+		seen[permission] = true
+		templates = append(templates, policyTemplate{Permission: permission, Policy: policy})
+	}
+	return templates, nil
+}
+
+// isSlot reports whether the scope is == the placeholder of slot
+func (s jsonScope) isSlot(slot string) bool {
+	return s.Op == "==" && s.Entity != nil && s.Entity.Type == templateSlotType && s.Entity.ID == slot
+}
+
+// link returns the template with its slots set to principal and resource.
+// The linked policy keeps the template's position for --explain.
+func (t policyTemplate) link(principal, resource cedar.EntityUID) *cedar.Policy {
+	linked := *t.Policy.AST()
+	linked.PrincipalEq(principal).ResourceEq(resource)
+	return cedar.NewPolicyFromAST(&linked)
+}
+
+// sampleLinks links every template to placeholder entities, so the templates
+// can be validated against the schema like the policies they become
+func sampleLinks(templates []policyTemplate, namespace cedarauthz.Namespace) *cedar.PolicySet {
+	policySet := cedar.NewPolicySet()
+	for _, template := range templates {
+		principal := cedar.NewEntityUID(namespace.User(), "?principal")
+		resource := cedar.NewEntityUID(namespace.Document(), "?resource")
+		policySet.Add(cedar.PolicyID(template.Permission+"/?resource/?principal"), template.link(principal, resource))
+	}
+	return policySet
+}
+
+// templateLinksQuery returns the document grants still in effect at $1, the
+// rows --templates links instead of building editors and viewers attributes
+const templateLinksQuery = `
+SELECT document_id, user_id, permission_type
+FROM document_permissions
+WHERE expires_at IS NULL OR expires_at > $1
+ORDER BY document_id, user_id, permission_type
+`
+
+// linkTemplates adds one policy per document_permissions row to policySet,
+// linking the template of the row's permission type. Linked policies are
+// named <permission>/<documentID>/<userID>. It returns the number of links.
+func linkTemplates(ctx context.Context, db *sql.DB, policySet *cedar.PolicySet, templates []policyTemplate, namespace cedarauthz.Namespace, at time.Time) (int, error) {
+	byPermission := make(map[string]policyTemplate, len(templates))
+	for _, template := range templates {
+		byPermission[template.Permission] = template
+	}
+
+	rows, err := db.QueryContext(ctx, templateLinksQuery, at)
+	if err != nil {
+		return 0, fmt.Errorf("template link query failed: %w", err)
+	}
+	defer rows.Close()
+
+	links := 0
+	for rows.Next() {
+		var documentID, userID, permission string
+		if err := rows.Scan(&documentID, &userID, &permission); err != nil {
+			return 0, fmt.Errorf("template link scan failed: %w", err)
+		}
+		template, ok := byPermission[permission]
+		if !ok {
+			return 0, fmt.Errorf("no template for permission %q of %s on %s", permission, userID, documentID)
+		}
+		principal := cedar.NewEntityUID(namespace.User(), cedar.String(userID))
+		resource := cedar.NewEntityUID(namespace.Document(), cedar.String(documentID))
+		id := cedar.PolicyID(fmt.Sprintf("%s/%s/%s", permission, documentID, userID))
+		policySet.Add(id, template.link(principal, resource))
+		links++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("template link iteration failed: %w", err)
+	}
+	return links, nil
+}
+
+// withoutDocumentPermissions wraps build so documents get empty editors and
+// viewers sets, leaving direct grants to the linked templates
+func withoutDocumentPermissions(build entityBuilder) entityBuilder {
+	return func(data *cedarauthz.EntityData, userID, documentID string) (cedar.EntityMap, cedar.EntityUID, cedar.EntityUID) {
+		unlinked := *data
+		unlinked.DocumentPermissions = nil
+		return build(&unlinked, userID, documentID)
+	}
+}
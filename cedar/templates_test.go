@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarauthz"
+	"simple-cedar-check/cedarload"
+)
+
+// templates.cedar is written in DocumentManagement and follows --namespace
+func TestLoadTemplatesFollowsNamespace(t *testing.T) {
+	for _, namespace := range []cedarauthz.Namespace{cedarauthz.DefaultNamespace, "Acme::Docs"} {
+		t.Run(string(namespace), func(t *testing.T) {
+			templates, err := loadTemplates(os.DirFS("."), "templates.cedar", namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys := namespacedFS(t, string(namespace))
+			cedarSchema, err := cedarload.LoadSchema(fsys, "schema.cedarschema")
+			if err != nil {
+				t.Fatal(err)
+			}
+			issues, err := validatePolicies(cedarSchema, sampleLinks(templates, namespace))
+			if err != nil || len(issues) > 0 {
+				t.Fatalf("templates don't validate: %v %v", issues, err)
+			}
+
+			// mallory's only way to doc2 is a linked viewer grant
+			policySet, err := cedarload.LoadPolicies(fsys, "policies.cedar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := fixtureEntityData("mallory", "doc2")
+			slice, err := buildEntitySlice(namespace, withoutDocumentPermissions(namespace.BuildEntities), data, "mallory", "doc2", entityLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			viewDocument := cedar.NewEntityUID(namespace.Action(), "ViewDocument")
+			for _, linked := range []bool{false, true} {
+				if linked {
+					for _, template := range templates {
+						if template.Permission == "viewer" {
+							policySet.Add("viewer/doc2/mallory", template.link(slice.Principal, slice.Resource))
+						}
+					}
+				}
+				allowed, _, err := checkAuthorization(policySet, slice, viewDocument, cedar.RecordMap{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if allowed != linked {
+					t.Errorf("mallory view doc2 with the viewer template linked=%v: got %v", linked, allowed)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAttributeVsTemplate compares a check that relies on a direct
+// viewer grant when the grants are a viewers attribute and when they are
+// linked templates. Every grant is on the checked document, the worst case
+// for the attribute, whose set is built per check; the linked policies are
+// evaluated on every check whichever document their grants are on. Linking
+// happens once at load time and isn't timed. The retained-B metric is what
+// each keeps on the heap: the entity slice of a check for the attribute, and
+// the linked policies for the templates.
+func BenchmarkAttributeVsTemplate(b *testing.B) {
+	templates, err := loadTemplates(os.DirFS("."), "templates.cedar", cedarauthz.DefaultNamespace)
+	if err != nil {
+		b.Fatal(err)
+	}
+	viewDocument := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Action(), "ViewDocument")
+	for _, grants := range []int{10, 1000, 100000} {
+		viewers := make([]string, grants)
+		for i := range viewers {
+			viewers[i] = fmt.Sprintf("user%d", i)
+		}
+		viewers[grants-1] = "mallory"
+		data := fixtureEntityData("mallory", "doc2")
+		data.DocumentPermissions = map[string][]string{"viewer": viewers}
+
+		attributes, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+		if err != nil {
+			b.Fatal(err)
+		}
+		linked, err := cedarload.LoadPolicies(os.DirFS("."), "policies.cedar")
+		if err != nil {
+			b.Fatal(err)
+		}
+		resource := cedar.NewEntityUID(cedarauthz.DefaultNamespace.Document(), "doc2")
+		linkedBytes := retainedBytes(func() any {
+			for _, template := range templates {
+				if template.Permission != "viewer" {
+					continue
+				}
+				for _, userID := range viewers {
+					principal := cedar.NewEntityUID(cedarauthz.DefaultNamespace.User(), cedar.String(userID))
+					linked.Add(cedar.PolicyID("viewer/doc2/"+userID), template.link(principal, resource))
+				}
+			}
+			return linked
+		})
+		attributeBytes := retainedBytes(func() any {
+			slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, cedarauthz.BuildEntities, data, "mallory", "doc2", entityLimits{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			return slice
+		})
+
+		for _, mode := range []struct {
+			name      string
+			policySet *cedar.PolicySet
+			build     entityBuilder
+			retained  uint64
+		}{
+			{"attributes", attributes, cedarauthz.BuildEntities, attributeBytes},
+			{"templates", linked, withoutDocumentPermissions(cedarauthz.BuildEntities), linkedBytes},
+		} {
+			b.Run(fmt.Sprintf("%s/grants=%d", mode.name, grants), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(mode.retained), "retained-B")
+				for i := 0; i < b.N; i++ {
+					slice, err := buildEntitySlice(cedarauthz.DefaultNamespace, mode.build, data, "mallory", "doc2", entityLimits{})
+					if err != nil {
+						b.Fatal(err)
+					}
+					allowed, _, err := checkAuthorization(mode.policySet, slice, viewDocument, cedar.RecordMap{})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if !allowed {
+						b.Fatal("mallory can't view doc2")
+					}
+				}
+			})
+		}
+	}
+}
+
+// retainedBytes returns how much the heap grew by what build returned, after
+// collecting everything else it allocated. Collecting twice also frees what
+// sync.Pool caches, which is otherwise noise of the size of small results.
+func retainedBytes(build func() any) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	kept := build()
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(kept)
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
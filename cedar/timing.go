@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"checktable"
+)
+
+// checkTiming is the --timing breakdown of a single check. With --entities
+// there is no query: reading the file counts towards EntityBuild.
+type checkTiming struct {
+	Query       time.Duration // the Postgres entity query
+	EntityBuild time.Duration // expiring grants and building the Cedar entities
+	Eval        time.Duration // cedar.Authorize
+	Total       time.Duration
+}
+
+func (t *checkTiming) String() string {
+	return fmt.Sprintf("query=%s entity_build=%s eval=%s total=%s",
+		checktable.FormatLatency(t.Query), checktable.FormatLatency(t.EntityBuild), checktable.FormatLatency(t.Eval), checktable.FormatLatency(t.Total))
+}
+
+// MarshalJSON encodes the durations in milliseconds, the unit of
+// openfga-check's --timing
+func (t *checkTiming) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Query       float64 `json:"query_ms"`
+		EntityBuild float64 `json:"entity_build_ms"`
+		Eval        float64 `json:"eval_ms"`
+		Total       float64 `json:"total_ms"`
+	}{milliseconds(t.Query), milliseconds(t.EntityBuild), milliseconds(t.Eval), milliseconds(t.Total)})
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
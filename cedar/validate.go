@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarload"
+)
+
+// policyIssue is a place where a policy doesn't match the schema
+type policyIssue struct {
+	PolicyID cedar.PolicyID
+	Position cedar.Position
+	Reason   string
+}
+
+func (i policyIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.Position.Filename, i.Position.Line, i.Position.Column, i.PolicyID, i.Reason)
+}
+
+// jsonScope mirrors the principal and resource scopes of the Cedar JSON
+// policy format
+type jsonScope struct {
+	Op         string          `json:"op"`
+	Entity     *jsonEntityRef  `json:"entity"`
+	Entities   []jsonEntityRef `json:"entities"`
+	EntityType string          `json:"entity_type"`
+	In         *struct {
+		Entity *jsonEntityRef `json:"entity"`
+	} `json:"in"`
+}
+
+// jsonPolicy mirrors the parts of the Cedar JSON policy format we validate
+type jsonPolicy struct {
+	Principal  jsonScope       `json:"principal"`
+	Action     jsonActionScope `json:"action"`
+	Resource   jsonScope       `json:"resource"`
+	Conditions []struct {
+		Body any `json:"body"`
+	} `json:"conditions"`
+}
+
+// validatePolicies checks every policy against schema: actions and entity
+// types must be declared, and attributes read from principal and resource
+// (and the entities they refer to) must exist on the types the policy's
+// actions apply to. cedar-go has no validator, so this covers the mistakes
+// that otherwise only show up as evaluation errors or silent denies.
+func validatePolicies(schema *cedarload.Schema, policySet *cedar.PolicySet) ([]policyIssue, error) {
+	var issues []policyIssue
+	for id, policy := range policySet.All() {
+		encoded, err := policy.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect policy %s: %w", id, err)
+		}
+		var parsed jsonPolicy
+		if err := json.Unmarshal(encoded, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to inspect policy %s: %w", id, err)
+		}
+
+		v := &policyValidator{schema: schema}
+		v.checkPolicy(parsed)
+		for _, reason := range v.reasons {
+			issues = append(issues, policyIssue{PolicyID: id, Position: policy.Position(), Reason: reason})
+		}
+	}
+	slices.SortStableFunc(issues, func(a, b policyIssue) int {
+		if c := strings.Compare(a.Position.Filename, b.Position.Filename); c != 0 {
+			return c
+		}
+		return a.Position.Offset - b.Position.Offset
+	})
+	return issues, nil
+}
+
+// policyValidator collects the schema violations of a single policy
+type policyValidator struct {
+	schema         *cedarload.Schema
+	principalTypes []string
+	resourceTypes  []string
+	reasons        []string
+}
+
+func (v *policyValidator) report(format string, args ...any) {
+	reason := fmt.Sprintf(format, args...)
+	if !slices.Contains(v.reasons, reason) {
+		v.reasons = append(v.reasons, reason)
+	}
+}
+
+func (v *policyValidator) checkPolicy(policy jsonPolicy) {
+	// The action scope decides which principal and resource types the
+	// conditions can see
+	actions := v.schema.ActionNames()
+	if policy.Action.Op != "All" {
+		actions = nil
+		refs := policy.Action.Entities
+		if policy.Action.Entity != nil {
+			refs = append(refs, *policy.Action.Entity)
+		}
+		for _, ref := range refs {
+			if ref.Type != v.schema.Namespace+"::Action" {
+				v.report("action %s::%q is not an action of namespace %s", ref.Type, ref.ID, v.schema.Namespace)
+				continue
+			}
+			if _, ok := v.schema.Actions[ref.ID]; !ok {
+				v.report("unknown action %q", ref.ID)
+				continue
+			}
+			actions = append(actions, ref.ID)
+		}
+	}
+	for _, action := range actions {
+		for _, t := range v.schema.Actions[action].PrincipalTypes {
+			v.principalTypes = appendUnique(v.principalTypes, t)
+		}
+		for _, t := range v.schema.Actions[action].ResourceTypes {
+			v.resourceTypes = appendUnique(v.resourceTypes, t)
+		}
+	}
+
+	v.principalTypes = v.checkScope(policy.Principal, v.principalTypes)
+	v.resourceTypes = v.checkScope(policy.Resource, v.resourceTypes)
+
+	for _, condition := range policy.Conditions {
+		v.walk(condition.Body)
+	}
+}
+
+// checkScope validates the entity types named by a principal or resource
+// scope and narrows types for "is" scopes
+func (v *policyValidator) checkScope(scope jsonScope, types []string) []string {
+	refs := scope.Entities
+	if scope.Entity != nil {
+		refs = append(refs, *scope.Entity)
+	}
+	if scope.In != nil && scope.In.Entity != nil {
+		refs = append(refs, *scope.In.Entity)
+	}
+	for _, ref := range refs {
+		v.checkEntityType(ref.Type)
+	}
+	if scope.EntityType != "" && v.checkEntityType(scope.EntityType) {
+		return []string{v.schema.UnqualifyType(scope.EntityType)}
+	}
+	return types
+}
+
+// checkEntityType reports entityType unless the schema declares it
+func (v *policyValidator) checkEntityType(entityType string) bool {
+	if _, ok := v.schema.EntityTypes[v.schema.UnqualifyType(entityType)]; !ok {
+		v.report("unknown entity type %q", entityType)
+		return false
+	}
+	return true
+}
+
+// walk visits every expression of a condition body
+func (v *policyValidator) walk(node any) {
+	switch n := node.(type) {
+	case map[string]any:
+		if _, ok := n["."]; ok {
+			v.typeOf(n)
+			return
+		}
+		if entity, ok := n["__entity"].(map[string]any); ok {
+			if entityType, ok := entity["type"].(string); ok {
+				v.checkEntityType(entityType)
+			}
+		}
+		if entityType, ok := n["entity_type"].(string); ok {
+			v.checkEntityType(entityType)
+		}
+		for _, child := range n {
+			v.walk(child)
+		}
+	case []any:
+		for _, child := range n {
+			v.walk(child)
+		}
+	}
+}
+
+// typeOf returns the entity types an expression can evaluate to, checking
+// attribute accesses along the way. It returns nil when the types can't be
+// determined, e.g. for context or literals.
+func (v *policyValidator) typeOf(node any) []string {
+	n, ok := node.(map[string]any)
+	if !ok {
+		v.walk(node)
+		return nil
+	}
+	switch {
+	case n["Var"] == "principal":
+		return v.principalTypes
+	case n["Var"] == "resource":
+		return v.resourceTypes
+	}
+	access, ok := n["."].(map[string]any)
+	if !ok {
+		v.walk(node)
+		return nil
+	}
+
+	leftTypes := v.typeOf(access["left"])
+	attr, _ := access["attr"].(string)
+	if len(leftTypes) == 0 {
+		return nil
+	}
+	var result []string
+	declared := false
+	for _, t := range leftTypes {
+		ref, ok := v.schema.AttributeEntity(t, attr)
+		if !ok {
+			continue
+		}
+		declared = true
+		if ref != "" {
+			result = appendUnique(result, ref)
+		}
+	}
+	if !declared {
+		v.report("attribute %q is not declared on %s", attr, strings.Join(leftTypes, " or "))
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarload"
+)
+
+func TestValidatePolicies(t *testing.T) {
+	cedarSchema, err := cedarload.LoadSchema(os.DirFS("."), "schema.cedarschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		policy string
+		want   []policyIssue // Filename of Position is always test.cedar
+	}{
+		{
+			name:   "valid",
+			policy: `permit (principal, action == DocumentManagement::Action::"ViewDocument", resource) when { resource.public };`,
+		},
+		{
+			name:   "unknown action",
+			policy: `permit (principal, action == DocumentManagement::Action::"ArchiveDocument", resource);`,
+			want: []policyIssue{{PolicyID: "policy0", Position: cedar.Position{Offset: 0, Line: 1, Column: 1},
+				Reason: `unknown action "ArchiveDocument"`}},
+		},
+		{
+			name:   "action of another namespace",
+			policy: `permit (principal, action == Acme::Action::"ViewDocument", resource);`,
+			want: []policyIssue{{PolicyID: "policy0", Position: cedar.Position{Offset: 0, Line: 1, Column: 1},
+				Reason: `action Acme::Action::"ViewDocument" is not an action of namespace DocumentManagement`}},
+		},
+		{
+			name:   "unknown entity type",
+			policy: "// teams\npermit (principal in DocumentManagement::Team::\"apollo\", action, resource);",
+			want: []policyIssue{{PolicyID: "policy0", Position: cedar.Position{Offset: 9, Line: 2, Column: 1},
+				Reason: `unknown entity type "DocumentManagement::Team"`}},
+		},
+		{
+			name:   "unknown attribute",
+			policy: `permit (principal, action == DocumentManagement::Action::"ViewDocument", resource) when { resource.nonexistent };`,
+			want: []policyIssue{{PolicyID: "policy0", Position: cedar.Position{Offset: 0, Line: 1, Column: 1},
+				Reason: `attribute "nonexistent" is not declared on Document`}},
+		},
+		{
+			name:   "unknown attribute of a referenced entity",
+			policy: `permit (principal, action == DocumentManagement::Action::"ViewDocument", resource) when { resource.parent_folder.workspace.owner == principal };`,
+			want: []policyIssue{{PolicyID: "policy0", Position: cedar.Position{Offset: 0, Line: 1, Column: 1},
+				Reason: `attribute "owner" is not declared on Workspace`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policySet, err := cedar.NewPolicySetFromBytes("test.cedar", []byte(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tt.want {
+				tt.want[i].Position.Filename = "test.cedar"
+			}
+			issues, err := validatePolicies(cedarSchema, policySet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(issues, tt.want) {
+				t.Errorf("got  %v\nwant %v", issues, tt.want)
+			}
+		})
+	}
+}
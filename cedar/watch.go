@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+// policyWatcher polls the policy file (or directory) for changes and
+// atomically swaps in the reloaded PolicySet. A reload that fails keeps the
+// previous good PolicySet, so a bad edit never takes checks down mid-run.
+type policyWatcher struct {
+	fsys        fs.FS
+	name        string
+	load        func() (*cedar.PolicySet, error)
+	reloading   sync.Mutex // serializes load and swap of run and reload
+	current     atomic.Pointer[cedar.PolicySet]
+	fingerprint string // of the last load attempt
+	pending     string // of the previous poll, while a change settles
+	statErr     string // last reported stat error
+}
+
+func newPolicyWatcher(fsys fs.FS, name string, initial *cedar.PolicySet, load func() (*cedar.PolicySet, error)) *policyWatcher {
+	w := &policyWatcher{fsys: fsys, name: name, load: load}
+	w.current.Store(initial)
+	w.fingerprint, _ = policyFingerprint(fsys, name)
+	return w
+}
+
+// PolicySet returns the most recently loaded good PolicySet
+func (w *policyWatcher) PolicySet() *cedar.PolicySet {
+	return w.current.Load()
+}
+
+// run polls for changes every interval until ctx is cancelled
+func (w *policyWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.reloadIfChanged()
+		}
+	}
+}
+
+func (w *policyWatcher) reloadIfChanged() {
+	fingerprint, err := policyFingerprint(w.fsys, w.name)
+	if err != nil {
+		// Editors may briefly remove the file while saving; report once
+		if err.Error() != w.statErr {
+			w.statErr = err.Error()
+			log.Printf("⚠️  Failed to stat policies, keeping the previous ones: %v", err)
+		}
+		return
+	}
+	w.statErr = ""
+	if fingerprint == w.fingerprint {
+		w.pending = ""
+		return
+	}
+	// Wait until the change has been stable for one poll, so a file that is
+	// still being written (e.g. truncated but not yet filled) isn't loaded
+	if fingerprint != w.pending {
+		w.pending = fingerprint
+		return
+	}
+	// Record the attempt even when it fails, so a broken file is reported once
+	// rather than on every poll
+	w.fingerprint = fingerprint
+	w.pending = ""
+
+	if w.reload() {
+		log.Printf("🔄 Reloaded policies from %s", w.name)
+	}
+}
+
+// reload loads the policies whether or not they changed, e.g. to link the
+// --templates grants again, and reports whether the new PolicySet was
+// swapped in. It is called from run and from the main goroutine, so loads
+// are serialized: otherwise a slower, older load could be swapped in last.
+func (w *policyWatcher) reload() bool {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+	policySet, err := w.load()
+	if err != nil {
+		log.Printf("⚠️  Failed to reload policies, keeping the previous ones: %v", err)
+		return false
+	}
+	w.current.Store(policySet)
+	return true
+}
+
+// policyFingerprint identifies the current contents of a policy file or of
+// the *.cedar files of a directory by name, size and modification time
+func policyFingerprint(fsys fs.FS, name string) (string, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("%d/%d", info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".cedar" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d/%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
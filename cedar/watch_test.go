@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"simple-cedar-check/cedarload"
+)
+
+// newTestWatcher returns a watcher of policies.cedar in a MapFS holding src
+func newTestWatcher(t *testing.T, src string) (*policyWatcher, fstest.MapFS) {
+	t.Helper()
+	fsys := fstest.MapFS{"policies.cedar": {Data: []byte(src), ModTime: time.Unix(1, 0)}}
+	load := func() (*cedar.PolicySet, error) { return cedarload.LoadPolicies(fsys, "policies.cedar") }
+	initial, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newPolicyWatcher(fsys, "policies.cedar", initial, load), fsys
+}
+
+// swap replaces policies.cedar with src, as an editor saving the file would
+func swap(fsys fstest.MapFS, src string, modTime int64) {
+	fsys["policies.cedar"] = &fstest.MapFile{Data: []byte(src), ModTime: time.Unix(modTime, 0)}
+}
+
+func policyCount(policySet *cedar.PolicySet) int {
+	n := 0
+	for range policySet.All() {
+		n++
+	}
+	return n
+}
+
+const (
+	onePolicy   = "permit (principal, action, resource);\n"
+	twoPolicies = "permit (principal, action, resource);\nforbid (principal, action, resource);\n"
+)
+
+func TestPolicyWatcherSwapsValidEdit(t *testing.T) {
+	w, fsys := newTestWatcher(t, onePolicy)
+	swap(fsys, twoPolicies, 2)
+	w.reloadIfChanged()
+	w.reloadIfChanged()
+	if got := policyCount(w.PolicySet()); got != 2 {
+		t.Errorf("got %d policies after the edit, want 2", got)
+	}
+}
+
+func TestPolicyWatcherKeepsPreviousOnParseFailure(t *testing.T) {
+	w, fsys := newTestWatcher(t, onePolicy)
+	previous := w.PolicySet()
+	swap(fsys, "permit (principal, action, resource)\nwhen { principal.owner == };\n", 2)
+	w.reloadIfChanged()
+	w.reloadIfChanged()
+	if w.PolicySet() != previous {
+		t.Error("a broken edit replaced the previous PolicySet")
+	}
+
+	// Fixing the file is picked up again
+	swap(fsys, twoPolicies, 3)
+	w.reloadIfChanged()
+	w.reloadIfChanged()
+	if got := policyCount(w.PolicySet()); got != 2 {
+		t.Errorf("got %d policies after the fix, want 2", got)
+	}
+}
+
+func TestPolicyWatcherWaitsForStableChange(t *testing.T) {
+	w, fsys := newTestWatcher(t, onePolicy)
+	previous := w.PolicySet()
+
+	// A file caught halfway through being written isn't loaded
+	swap(fsys, "", 2)
+	w.reloadIfChanged()
+	if w.PolicySet() != previous {
+		t.Fatal("a change was loaded on the poll that first saw it")
+	}
+	// It keeps changing, so the next poll waits again
+	swap(fsys, twoPolicies, 3)
+	w.reloadIfChanged()
+	if w.PolicySet() != previous {
+		t.Fatal("a change was loaded before it was stable for one poll")
+	}
+	// Unchanged since the previous poll
+	w.reloadIfChanged()
+	if got := policyCount(w.PolicySet()); got != 2 {
+		t.Errorf("got %d policies once the change settled, want 2", got)
+	}
+}
@@ -0,0 +1,3 @@
+module checktable
+
+go 1.21
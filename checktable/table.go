@@ -0,0 +1,99 @@
+// Package checktable renders the --output table of cedar-check and
+// openfga-check, so both tools print the same columns in the same layout.
+package checktable
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultColumnWidth is the width cells are truncated to unless --wide is set
+const DefaultColumnWidth = 32
+
+// Columns are the columns of --output table, in their stable order
+var Columns = []string{"DECISION", "ENGINE", "USER", "RESOURCE", "ACTION", "LATENCY"}
+
+// decisionColors are the ANSI colors of the DECISION column
+var decisionColors = map[string]string{
+	"ALLOW": "\x1b[32m",
+	"DENY":  "\x1b[31m",
+}
+
+// Table renders rows as aligned, ASCII-only columns under a header row
+type Table struct {
+	Header   []string
+	Rows     [][]string
+	MaxWidth int  // cells wider than this are truncated with "..."; 0 disables truncation
+	Color    bool // color the first column with decisionColors
+}
+
+// Write renders the table to w
+func (t *Table) Write(w io.Writer) error {
+	rows := append([][]string{t.Header}, t.Rows...)
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = truncateCell(cell, t.MaxWidth)
+		}
+		rows[i] = cells
+	}
+
+	widths := make([]int, len(t.Header))
+	for _, row := range rows {
+		for j, cell := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cell))
+		}
+	}
+
+	for i, row := range rows {
+		var b strings.Builder
+		for j, cell := range row {
+			width := utf8.RuneCountInString(cell)
+			if color, ok := decisionColors[cell]; ok && t.Color && i > 0 && j == 0 {
+				cell = color + cell + "\x1b[0m"
+			}
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-width+2))
+			}
+		}
+		if _, err := fmt.Fprintln(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateCell shortens cell to width runes, ending it with "..."
+func truncateCell(cell string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	if width <= 3 {
+		return strings.Repeat(".", width)
+	}
+	return string([]rune(cell)[:width-3]) + "..."
+}
+
+// UseColor decides whether to emit ANSI colors: --no-color wins over
+// --color, and without either colors are used when stdout is a terminal
+func UseColor(force, disable bool) bool {
+	switch {
+	case disable:
+		return false
+	case force:
+		return true
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// FormatLatency renders d in milliseconds, avoiding the "µs" of
+// time.Duration.String so the output stays ASCII
+func FormatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,73 @@
+package checktable
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata golden files")
+
+// rows are checks of both engines, with a document ID long enough to be
+// truncated at DefaultColumnWidth
+var rows = [][]string{
+	{"ALLOW", "cedar", "alice", "doc1", "view", FormatLatency(1234 * time.Microsecond)},
+	{"DENY", "openfga", "david", "doc1", "edit", FormatLatency(56 * time.Millisecond)},
+	{"ALLOW", "cedar", "charlie", "quarterly-planning-2026-engineering-offsite", "view", FormatLatency(0)},
+}
+
+func TestTableGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		table  Table
+	}{
+		{"table.txt", Table{Header: Columns, Rows: rows, MaxWidth: DefaultColumnWidth}},
+		{"table-wide.txt", Table{Header: Columns, Rows: rows}},
+		{"table-color.txt", Table{Header: Columns, Rows: rows, MaxWidth: DefaultColumnWidth, Color: true}},
+		{"table-empty.txt", Table{Header: Columns, MaxWidth: DefaultColumnWidth}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.table.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("table differs from %s (rerun with -update to accept):\n%s", golden, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestTruncateCell(t *testing.T) {
+	tests := []struct {
+		cell  string
+		width int
+		want  string
+	}{
+		{"document", 0, "document"},
+		{"document", 8, "document"},
+		{"document", 7, "docu..."},
+		{"document", 3, "..."},
+		{"document", 2, ".."},
+		{"dökümän", 6, "dök..."},
+	}
+	for _, tt := range tests {
+		if got := truncateCell(tt.cell, tt.width); got != tt.want {
+			t.Errorf("truncateCell(%q, %d) = %q, want %q", tt.cell, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+// checkResult is the --output json form of a check, in the shape of
+// cedar-check's
+type checkResult struct {
+	Principal string       `json:"principal"`
+	Action    string       `json:"action"`
+	Resource  string       `json:"resource"`
+	Decision  string       `json:"decision"` // "allow" or "deny"
+	Timing    *checkTiming `json:"timing,omitempty"`
+}
+
+// documentPermissions returns the can_* relations of the document type, the
+// counterparts of the Cedar document actions, in sorted order
+func documentPermissions(model *openfga.AuthorizationModel) ([]string, error) {
+	document, ok := typeDefinitions(model)["document"]
+	if !ok {
+		return nil, fmt.Errorf("%w: no document type", ErrModelError)
+	}
+	var relations []string
+	for relation := range document.GetRelations() {
+		if strings.HasPrefix(relation, "can_") {
+			relations = append(relations, relation)
+		}
+	}
+	slices.Sort(relations)
+	return relations, nil
+}
+
+// relationVerb returns the action name of a can_* relation, e.g. "view"
+func relationVerb(relation string) string {
+	return strings.TrimPrefix(relation, "can_")
+}
+
+// documentRelation resolves an --action value, either a short name such as
+// "edit", a relation such as "can_edit" or the Cedar action name such as
+// "EditDocument", to the can_* relation of the document type and its short
+// name. Whether the model defines the relation is left to the server, which
+// fails the check with ErrModelError otherwise.
+func documentRelation(action string) (string, string, error) {
+	verb := strings.ToLower(action)
+	if short, ok := strings.CutPrefix(verb, "can_"); ok {
+		verb = short
+	} else if short, ok := strings.CutSuffix(verb, "document"); ok {
+		verb = short
+	}
+	if verb == "" || strings.ContainsAny(verb, ":#@ \t\n") {
+		return "", "", fmt.Errorf("invalid action %q (e.g. view, edit, delete or share)", action)
+	}
+	return "can_" + verb, verb, nil
+}
+
+// listRelations returns which of relations userID has on documentID, checking
+// them in one ListRelations call with the condition context of
+// checkAuthorization
+func listRelations(ctx context.Context, fgaClient *client.OpenFgaClient, userID, documentID string, relations []string, requestContext map[string]interface{}) ([]string, error) {
+	body := client.ClientListRelationsRequest{
+		User:      fmt.Sprintf("user:%s", userID),
+		Object:    fmt.Sprintf("document:%s", documentID),
+		Relations: relations,
+		Context:   &requestContext,
+	}
+	// Like plain checks, leave the consistency preference to the server
+	consistency := primaryConsistency(false)
+	options := client.ClientListRelationsOptions{
+		Consistency: &consistency,
+	}
+
+	data, err := fgaClient.ListRelations(ctx).Body(body).Options(options).Execute()
+	if err != nil {
+		var validationErr openfga.FgaApiValidationError
+		if errors.As(err, &validationErr) && isModelError(validationErr) {
+			return nil, fmt.Errorf("%w: %s", ErrModelError, validationErr.Error())
+		}
+		return nil, fmt.Errorf("list relations request failed: %w", err)
+	}
+	return data.Relations, nil
+}
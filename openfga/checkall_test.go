@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestDocumentRelation(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		wantRelation string
+		wantVerb     string
+		wantErr      bool
+	}{
+		{"short name", "view", "can_view", "view", false},
+		{"relation", "can_edit", "can_edit", "edit", false},
+		{"Cedar action name", "DeleteDocument", "can_delete", "delete", false},
+		{"any case", "SHARE", "can_share", "share", false},
+		{"relation the model doesn't define", "archive", "can_archive", "archive", false},
+		{"empty", "", "", "", true},
+		{"bare prefix", "can_", "", "", true},
+		{"object reference", "document:doc1", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relation, verb, err := documentRelation(tt.action)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", relation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if relation != tt.wantRelation || verb != tt.wantVerb {
+				t.Errorf("got %s (%s), want %s (%s)", relation, verb, tt.wantRelation, tt.wantVerb)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+)
+
+// primaryConsistency returns the consistency preference of the check whose
+// decision is printed: the server's default, unless --dual-consistency
+// compares MINIMIZE_LATENCY with HIGHER_CONSISTENCY
+func primaryConsistency(dualConsistency bool) openfga.ConsistencyPreference {
+	if dualConsistency {
+		return openfga.CONSISTENCYPREFERENCE_MINIMIZE_LATENCY
+	}
+	return openfga.CONSISTENCYPREFERENCE_UNSPECIFIED
+}
+
+// consistencySample is one --dual-consistency comparison, a line of the
+// --consistency-log file
+type consistencySample struct {
+	At                time.Time `json:"at"`
+	Principal         string    `json:"principal"`
+	Action            string    `json:"action"`
+	Resource          string    `json:"resource"`
+	MinimizeLatency   bool      `json:"minimize_latency"`
+	HigherConsistency bool      `json:"higher_consistency"`
+}
+
+// consistencyStats aggregates the comparisons of a --consistency-log file
+type consistencyStats struct {
+	Checks        int
+	Disagreements int
+}
+
+func (s consistencyStats) String() string {
+	rate := 0.0
+	if s.Checks > 0 {
+		rate = 100 * float64(s.Disagreements) / float64(s.Checks)
+	}
+	return fmt.Sprintf("%d of %d checks disagreed (%.2f%%)", s.Disagreements, s.Checks, rate)
+}
+
+// recordConsistency appends sample to the log at path, creating it, and
+// returns the stats of every comparison the log holds. Each sample is a
+// single append, so concurrent runs can share a log.
+func recordConsistency(path string, sample consistencySample) (consistencyStats, error) {
+	encoded, err := json.Marshal(sample)
+	if err != nil {
+		return consistencyStats{}, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return consistencyStats{}, err
+	}
+	_, err = f.Write(append(encoded, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return consistencyStats{}, err
+	}
+
+	f, err = os.Open(path)
+	if err != nil {
+		return consistencyStats{}, err
+	}
+	defer f.Close()
+	return readConsistencyStats(f)
+}
+
+// readConsistencyStats aggregates the samples of a --consistency-log file
+func readConsistencyStats(r io.Reader) (consistencyStats, error) {
+	var stats consistencyStats
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var sample consistencySample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return consistencyStats{}, fmt.Errorf("line %d: %w", line, err)
+		}
+		stats.Checks++
+		if sample.MinimizeLatency != sample.HigherConsistency {
+			stats.Disagreements++
+		}
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+)
+
+// Without --dual-consistency a check leaves the consistency to the server
+func TestPrimaryConsistency(t *testing.T) {
+	if got := primaryConsistency(false); got != openfga.CONSISTENCYPREFERENCE_UNSPECIFIED {
+		t.Errorf("plain check: got %s, want UNSPECIFIED", got)
+	}
+	if got := primaryConsistency(true); got != openfga.CONSISTENCYPREFERENCE_MINIMIZE_LATENCY {
+		t.Errorf("--dual-consistency: got %s, want MINIMIZE_LATENCY", got)
+	}
+}
+
+func TestRecordConsistency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consistency.jsonl")
+	at := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	samples := []consistencySample{
+		{At: at, Principal: "user:alice", Action: "can_view", Resource: "document:doc1", MinimizeLatency: true, HigherConsistency: true},
+		{At: at, Principal: "user:bob", Action: "can_edit", Resource: "document:doc4", MinimizeLatency: false, HigherConsistency: true},
+		{At: at, Principal: "user:eve", Action: "can_view", Resource: "document:doc2", MinimizeLatency: false, HigherConsistency: false},
+		{At: at, Principal: "user:charlie", Action: "can_view", Resource: "document:doc2", MinimizeLatency: true, HigherConsistency: false},
+	}
+	var stats consistencyStats
+	for _, sample := range samples {
+		var err error
+		if stats, err = recordConsistency(path, sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (consistencyStats{Checks: 4, Disagreements: 2}); stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+	if got, want := stats.String(), "2 of 4 checks disagreed (50.00%)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Every comparison is kept, with its time and object, for later analysis
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(logged)), "\n")
+	want := `{"at":"2025-06-01T00:00:00Z","principal":"user:bob","action":"can_edit","resource":"document:doc4","minimize_latency":false,"higher_consistency":true}`
+	if len(lines) != len(samples) || lines[1] != want {
+		t.Errorf("got log\n%s\nwant line 2\n%s", logged, want)
+	}
+}
+
+func TestReadConsistencyStatsReportsBrokenLine(t *testing.T) {
+	_, err := readConsistencyStats(strings.NewReader(`{"minimize_latency":true,"higher_consistency":true}` + "\n\n{\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("got error %v, want one on line 3", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidContext is returned when --context isn't a JSON object
+var ErrInvalidContext = errors.New("invalid request context")
+
+// checkContext returns the condition context sent with every check: the
+// --context JSON object, with at as the current_time of non_expired. mfa
+// defaults to false, because OpenFGA fails a check whose mfa_verified tuple
+// lacks it, where Cedar's `context has mfa` just denies.
+func checkContext(raw string, at time.Time) (map[string]interface{}, error) {
+	requestContext := map[string]interface{}{}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &requestContext); err != nil || requestContext == nil {
+			return nil, fmt.Errorf(`%w: expected a JSON object, e.g. {"mfa": true}`, ErrInvalidContext)
+		}
+	}
+	if _, ok := requestContext["current_time"]; ok {
+		return nil, fmt.Errorf("%w: current_time is set by --at", ErrInvalidContext)
+	}
+	requestContext["current_time"] = at.UTC().Format(time.RFC3339)
+	if _, ok := requestContext["mfa"]; !ok {
+		requestContext["mfa"] = false
+	}
+	return requestContext, nil
+}
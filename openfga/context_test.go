@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckContext(t *testing.T) {
+	at := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{"no context", "", map[string]interface{}{"current_time": "2025-06-01T00:00:00Z", "mfa": false}, false},
+		{"mfa missing", `{"ip": "10.0.0.1"}`, map[string]interface{}{"current_time": "2025-06-01T00:00:00Z", "mfa": false, "ip": "10.0.0.1"}, false},
+		{"mfa false", `{"mfa": false}`, map[string]interface{}{"current_time": "2025-06-01T00:00:00Z", "mfa": false}, false},
+		{"mfa true", `{"mfa": true}`, map[string]interface{}{"current_time": "2025-06-01T00:00:00Z", "mfa": true}, false},
+		{"current_time is set by --at", `{"current_time": "2020-01-01T00:00:00Z"}`, nil, true},
+		{"not an object", `[true]`, nil, true},
+		{"null", `null`, nil, true},
+		{"invalid JSON", `{"mfa": }`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkContext(tt.raw, at)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidContext) {
+					t.Fatalf("got error %v, want ErrInvalidContext", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
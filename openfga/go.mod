@@ -2,7 +2,10 @@ module openfga-authorization-example
 
 go 1.21
 
-require github.com/openfga/go-sdk v0.6.2
+require (
+	checktable v0.0.0
+	github.com/openfga/go-sdk v0.6.2
+)
 
 require (
 	github.com/go-logr/logr v1.4.2 // indirect
@@ -12,3 +15,5 @@ require (
 	go.opentelemetry.io/otel/trace v1.29.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 )
+
+replace checktable => ../checktable
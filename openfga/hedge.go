@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openfga/go-sdk/client"
+)
+
+// hedgeOutcome records whether a hedged request was issued and which one won
+type hedgeOutcome struct {
+	Hedged   bool
+	HedgeWon bool
+}
+
+// print reports the hedge outcome for a single check
+func (h hedgeOutcome) print(delay time.Duration) {
+	switch {
+	case !h.Hedged:
+		fmt.Printf("🏁 Hedge not needed: check returned within %s\n", delay)
+	case h.HedgeWon:
+		fmt.Printf("🏁 Hedge issued after %s and won\n", delay)
+	default:
+		fmt.Printf("🏁 Hedge issued after %s but the original check won\n", delay)
+	}
+}
+
+// hedgedCheck runs request and, if it hasn't returned within delay, issues a
+// second identical check and returns whichever succeeds first. The loser is
+// cancelled through ctx. A failed attempt only wins when the other one fails
+// too. It only takes a check request, since hedging a write would apply the
+// duplicate twice. A delay of 0 disables hedging.
+//
+// The delay is fixed rather than derived from the p95 of past checks, and
+// there is no cap on the share of hedged requests: openfga-check makes a
+// single check per run, so there is no latency history to derive them from.
+func hedgedCheck(ctx context.Context, fgaClient *client.OpenFgaClient, delay time.Duration, request checkRequest) (bool, hedgeOutcome, error) {
+	if delay <= 0 {
+		allowed, err := checkAuthorization(ctx, fgaClient, request)
+		return allowed, hedgeOutcome{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		allowed bool
+		err     error
+		hedge   bool
+	}
+	results := make(chan attempt, 2)
+	launch := func(hedge bool) {
+		go func() {
+			allowed, err := checkAuthorization(ctx, fgaClient, request)
+			results <- attempt{allowed: allowed, err: err, hedge: hedge}
+		}()
+	}
+
+	launch(false)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var outcome hedgeOutcome
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			outcome.Hedged = true
+			launch(true)
+			pending++
+		case result := <-results:
+			pending--
+			if result.err != nil && pending > 0 {
+				// Wait for the other attempt before giving up
+				continue
+			}
+			outcome.HedgeWon = result.hedge
+			return result.allowed, outcome, result.err
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+// newCheckServer starts an OpenFGA stand-in that answers the nth check
+// request (counting from 1) with respond, and returns a client of it
+func newCheckServer(t *testing.T, respond func(n int, w http.ResponseWriter, r *http.Request)) (*client.OpenFgaClient, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices a cancelled request once the body is read
+		io.Copy(io.Discard, r.Body)
+		respond(int(requests.Add(1)), w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	fgaClient, err := client.NewSdkClient(&client.ClientConfiguration{
+		ApiUrl:  server.URL,
+		StoreId: "01HVMMBCMGZNT3SED4Z17ECXCA",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fgaClient, &requests
+}
+
+func writeAllowed(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"allowed": true}`))
+}
+
+func TestHedgedCheck(t *testing.T) {
+	request := checkRequest{UserID: "alice", Relation: "can_view", DocumentID: "doc1",
+		Context: map[string]interface{}{}, Consistency: openfga.CONSISTENCYPREFERENCE_MINIMIZE_LATENCY}
+
+	t.Run("no hedge", func(t *testing.T) {
+		fgaClient, requests := newCheckServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+			writeAllowed(w)
+		})
+		allowed, outcome, err := hedgedCheck(context.Background(), fgaClient, time.Second, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed || outcome != (hedgeOutcome{}) || requests.Load() != 1 {
+			t.Errorf("got allowed=%t %+v after %d requests, want one unhedged allow", allowed, outcome, requests.Load())
+		}
+	})
+
+	t.Run("hedge wins", func(t *testing.T) {
+		fgaClient, requests := newCheckServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+			if n == 1 {
+				// Stall until the hedge wins and the original is cancelled
+				<-r.Context().Done()
+				return
+			}
+			writeAllowed(w)
+		})
+		allowed, outcome, err := hedgedCheck(context.Background(), fgaClient, 10*time.Millisecond, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed || outcome != (hedgeOutcome{Hedged: true, HedgeWon: true}) || requests.Load() != 2 {
+			t.Errorf("got allowed=%t %+v after %d requests, want an allow of the hedge", allowed, outcome, requests.Load())
+		}
+	})
+
+	t.Run("original fails while the hedge succeeds", func(t *testing.T) {
+		hedged := make(chan struct{})
+		fgaClient, requests := newCheckServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+			if n == 1 {
+				// Fail only once the hedge is in flight
+				<-hedged
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code": "validation_error", "message": "invalid request"}`))
+				return
+			}
+			close(hedged)
+			time.Sleep(50 * time.Millisecond)
+			writeAllowed(w)
+		})
+		allowed, outcome, err := hedgedCheck(context.Background(), fgaClient, 10*time.Millisecond, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed || outcome != (hedgeOutcome{Hedged: true, HedgeWon: true}) || requests.Load() != 2 {
+			t.Errorf("got allowed=%t %+v after %d requests, want an allow of the hedge", allowed, outcome, requests.Load())
+		}
+	})
+}
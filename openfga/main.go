@@ -2,23 +2,282 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	openfga "github.com/openfga/go-sdk"
 	"github.com/openfga/go-sdk/client"
+
+	"checktable"
 )
 
+// ErrModelError is returned when a check references a type or relation the
+// authorization model doesn't define, instead of a generic request failure
+var ErrModelError = errors.New("authorization model error")
+
+// consistencyResult holds the outcome of a check issued at a given consistency level
+type consistencyResult struct {
+	allowed bool
+	err     error
+	at      time.Time
+}
+
 func main() {
-	if len(os.Args) < 3 {
-		log.Fatal("Usage: ./openfga-check <userID> <documentID>")
+	actionName := flag.String("action", "view", "document action to check: a short name such as view or edit, a can_* relation or the Cedar action name")
+	dualConsistency := flag.Bool("dual-consistency", false, "run the check with MINIMIZE_LATENCY and HIGHER_CONSISTENCY and report disagreements")
+	consistencyLog := flag.String("consistency-log", "", "with --dual-consistency, append each comparison to this JSON lines file and print the disagreement rate across it")
+	modelID := flag.String("model-id", os.Getenv("OPENFGA_MODEL_ID"), "authorization model ID to use instead of discovering the latest one")
+	timing := flag.Bool("timing", false, "print the round-trip time of the check, lined up with cedar-check --timing")
+	traceLatency := flag.Bool("trace-latency", false, "print DNS, connect, TLS, time-to-first-byte and server time per OpenFGA call")
+	hedgeDelay := flag.Duration("hedge-delay", 0, "issue a second identical check if the first hasn't returned within this delay (0 disables hedging)")
+	output := flag.String("output", "text", "output format: text, table or json")
+	wide := flag.Bool("wide", false, "don't truncate long IDs in --output table")
+	forceColor := flag.Bool("color", false, "color --output table decisions even when stdout is not a terminal")
+	noColor := flag.Bool("no-color", false, "never color --output table decisions")
+	useLatest := flag.Bool("use-latest", false, "use the latest authorization model even when --model-id or OPENFGA_MODEL_ID pins another one")
+	warnStale := flag.Bool("warn-stale", false, "also look up the latest authorization model and warn when the pinned one is older")
+	atFlag := flag.String("at", "", "evaluate time-bounded shares at this RFC3339 time instead of now, e.g. 2025-06-01T00:00:00Z")
+	contextJSON := flag.String("context", "", `condition context as a JSON object, e.g. '{"mfa": true}'`)
+	flag.Parse()
+
+	config := &client.ClientConfiguration{
+		ApiUrl: "http://localhost:8080", // OpenFGA server URL
+	}
+	var tracer *tracingTransport
+	if *traceLatency {
+		tracer = newTracingTransport(http.DefaultTransport)
+		config.HTTPClient = &http.Client{Transport: tracer}
+	}
+
+	if flag.Arg(0) == "model" {
+		err := runModelCommand(context.Background(), func() *client.OpenFgaClient { return connect(config) }, flag.Args()[1:])
+		if err != nil {
+			log.Fatal("Model command failed:", err)
+		}
+		return
+	}
+
+	if flag.NArg() < 2 {
+		log.Fatal("Usage: ./openfga-check [--action <action>] [--model-id <id>] [--use-latest] [--warn-stale] [--dual-consistency [--consistency-log <file>]] [--trace-latency] [--hedge-delay <duration>] [--output text|table|json] [--at <RFC3339 time>] [--context <JSON object>] <userID> <documentID>\n       ./openfga-check [flags] check-all <userID> <documentID>\n       ./openfga-check model list | model diff <idA|file.json> <idB|file.json>")
+	}
+	userID, documentID := flag.Arg(0), flag.Arg(1)
+	checkAll := flag.Arg(0) == "check-all"
+	if checkAll {
+		if flag.NArg() < 3 {
+			log.Fatal("Usage: ./openfga-check [flags] check-all <userID> <documentID>")
+		}
+		userID, documentID = flag.Arg(1), flag.Arg(2)
+		if *dualConsistency || *hedgeDelay > 0 || *timing {
+			log.Fatal("Invalid request: check-all can't be combined with --dual-consistency, --hedge-delay or --timing")
+		}
+	}
+	if *consistencyLog != "" && !*dualConsistency {
+		log.Fatal("Invalid request: --consistency-log requires --dual-consistency")
+	}
+	relation, verb, err := documentRelation(*actionName)
+	if err != nil {
+		log.Fatal("Invalid request: ", err)
+	}
+	if *output != "text" && *output != "table" && *output != "json" {
+		log.Fatalf("Invalid request: unknown output format %q (valid formats: text, table, json)", *output)
+	}
+	columnWidth := checktable.DefaultColumnWidth
+	if *wide {
+		columnWidth = 0
+	}
+	at := time.Now()
+	if *atFlag != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			log.Fatal("Invalid request: --at must be an RFC3339 time:", err)
+		}
+	}
+	requestContext, err := checkContext(*contextJSON, at)
+	if err != nil {
+		log.Fatal("Invalid request: ", err)
+	}
+
+	fgaClient := connect(config)
+
+	// Get the authorization model ID, discovering the latest one only when
+	// none was pinned. With --warn-stale a pinned model that is no longer the
+	// latest is reported, since checks against it silently diverge from the
+	// current one; that lookup is best-effort and never fails the check.
+	if *modelID == "" || *useLatest {
+		latestID, err := latestModelID(context.Background(), fgaClient)
+		if err != nil {
+			log.Fatal("Failed to find the latest authorization model:", err)
+		}
+		*modelID = latestID
+	} else if *warnStale {
+		latestID, err := latestModelID(context.Background(), fgaClient)
+		if err != nil {
+			log.Printf("⚠️  Could not check whether pinned model %s is the latest: %v", *modelID, err)
+		} else if *modelID != latestID {
+			log.Printf("⚠️  Pinned model %s is not the latest (%s); compare them with `./openfga-check model diff %s %s`, or pass --use-latest",
+				*modelID, latestID, *modelID, latestID)
+		}
+	}
+	if err := fgaClient.SetAuthorizationModelId(*modelID); err != nil {
+		log.Fatal("Invalid authorization model ID:", err)
+	}
+
+	// Check every can_* relation of the model in one ListRelations call
+	if checkAll {
+		model, err := loadModel(context.Background(), func() *client.OpenFgaClient { return fgaClient }, *modelID)
+		if err != nil {
+			log.Fatal("Failed to read the authorization model:", err)
+		}
+		relations, err := documentPermissions(model)
+		if err != nil {
+			log.Fatal("Authorization model has no document permissions: ", err)
+		}
+		start := time.Now()
+		allowed, err := listRelations(context.Background(), fgaClient, userID, documentID, relations, requestContext)
+		latency := time.Since(start)
+		if errors.Is(err, ErrModelError) {
+			log.Fatal("Authorization model is missing a type or relation used by the check: ", err)
+		}
+		if err != nil {
+			log.Fatal("Authorization check failed:", err)
+		}
+
+		result := &checktable.Table{Header: checktable.Columns, MaxWidth: columnWidth, Color: checktable.UseColor(*forceColor, *noColor)}
+		for _, relation := range relations {
+			ok := slices.Contains(allowed, relation)
+			switch {
+			case *output == "json":
+				printJSONResult(userID, relation, documentID, ok, nil)
+			case *output == "table":
+				decision := "DENY"
+				if ok {
+					decision = "ALLOW"
+				}
+				// The relations share one call, so every row shows its latency
+				result.Rows = append(result.Rows, []string{decision, "openfga", userID, documentID, relationVerb(relation), checktable.FormatLatency(latency)})
+			case ok:
+				fmt.Printf("✅ ALLOWED: %s can %s %s\n", userID, relationVerb(relation), documentID)
+			default:
+				fmt.Printf("❌ DENIED: %s cannot %s %s\n", userID, relationVerb(relation), documentID)
+			}
+		}
+		if *output == "table" {
+			if err := result.Write(os.Stdout); err != nil {
+				log.Fatal("Failed to print results:", err)
+			}
+		}
+		if *output == "text" {
+			fmt.Printf("📋 %d relations checked in %s\n", len(relations), checktable.FormatLatency(latency))
+		}
+		if tracer != nil {
+			tracer.printLatencyBreakdown()
+		}
+		return
+	}
+
+	// Issue the HIGHER_CONSISTENCY variant in the background so the primary
+	// check's latency is not affected by it
+	var secondary chan consistencyResult
+	if *dualConsistency {
+		secondary = make(chan consistencyResult, 1)
+		go func() {
+			request := checkRequest{UserID: userID, Relation: relation, DocumentID: documentID, Context: requestContext, Consistency: openfga.CONSISTENCYPREFERENCE_HIGHER_CONSISTENCY}
+			allowed, err := checkAuthorization(context.Background(), fgaClient, request)
+			secondary <- consistencyResult{allowed: allowed, err: err, at: time.Now()}
+		}()
+	}
+
+	// Perform authorization check, hedging it when a delay is configured
+	start := time.Now()
+	request := checkRequest{UserID: userID, Relation: relation, DocumentID: documentID, Context: requestContext, Consistency: primaryConsistency(*dualConsistency)}
+	allowed, hedge, err := hedgedCheck(context.Background(), fgaClient, *hedgeDelay, request)
+	latency := time.Since(start)
+	if errors.Is(err, ErrModelError) {
+		log.Fatal("Authorization model is missing a type or relation used by the check: ", err)
+	}
+	if err != nil {
+		log.Fatal("Authorization check failed:", err)
+	}
+
+	// Print result
+	var elapsed *checkTiming
+	if *timing {
+		elapsed = &checkTiming{RoundTrip: latency}
+	}
+	if *output == "json" {
+		printJSONResult(userID, relation, documentID, allowed, elapsed)
+	} else if *output == "table" {
+		decision := "DENY"
+		if allowed {
+			decision = "ALLOW"
+		}
+		result := &checktable.Table{
+			Header:   checktable.Columns,
+			Rows:     [][]string{{decision, "openfga", userID, documentID, verb, checktable.FormatLatency(latency)}},
+			MaxWidth: columnWidth,
+			Color:    checktable.UseColor(*forceColor, *noColor),
+		}
+		if err := result.Write(os.Stdout); err != nil {
+			log.Fatal("Failed to print result:", err)
+		}
+	} else if allowed {
+		fmt.Printf("✅ ALLOWED: %s can %s %s\n", userID, verb, documentID)
+	} else {
+		fmt.Printf("❌ DENIED: %s cannot %s %s\n", userID, verb, documentID)
+	}
+	// Keep stdout parseable in --output table and json
+	if elapsed != nil && *output == "text" {
+		fmt.Printf("⏱️  Timing: %s\n", elapsed)
+	} else if elapsed != nil && *output == "table" {
+		fmt.Fprintf(os.Stderr, "⏱️  Timing: %s\n", elapsed)
+	}
+
+	if *hedgeDelay > 0 {
+		hedge.print(*hedgeDelay)
+	}
+
+	if secondary != nil {
+		result := <-secondary
+		reportConsistencyDisagreement(userID, relation, documentID, allowed, result)
+		if *consistencyLog != "" && result.err == nil {
+			stats, err := recordConsistency(*consistencyLog, consistencySample{
+				At:                result.at.UTC(),
+				Principal:         fmt.Sprintf("user:%s", userID),
+				Action:            relation,
+				Resource:          fmt.Sprintf("document:%s", documentID),
+				MinimizeLatency:   allowed,
+				HigherConsistency: result.allowed,
+			})
+			if err != nil {
+				log.Fatal("Failed to record the consistency comparison:", err)
+			}
+			// Keep stdout parseable in --output table and json
+			if *output == "text" {
+				fmt.Printf("📈 Disagreement rate: %s in %s\n", stats, *consistencyLog)
+			} else {
+				fmt.Fprintf(os.Stderr, "📈 Disagreement rate: %s in %s\n", stats, *consistencyLog)
+			}
+		}
 	}
-	userID, documentID := os.Args[1], os.Args[2]
 
+	if tracer != nil {
+		tracer.printLatencyBreakdown()
+	}
+}
+
+// connect creates the OpenFGA client and selects the store, exiting on failure
+func connect(config *client.ClientConfiguration) *client.OpenFgaClient {
 	// Create OpenFGA client
-	fgaClient, err := client.NewSdkClient(&client.ClientConfiguration{
-		ApiUrl: "http://localhost:8080", // OpenFGA server URL
-	})
+	fgaClient, err := client.NewSdkClient(config)
 	if err != nil {
 		log.Fatal("Failed to create OpenFGA client:", err)
 	}
@@ -37,53 +296,100 @@ func main() {
 		}
 		
 		storeID = stores.Stores[0].Id
-		fmt.Printf("Using store: %s\n", storeID)
+		// Keep stdout parseable in --output json
+		fmt.Fprintf(os.Stderr, "Using store: %s\n", storeID)
 	}
 
 	// Set the store ID
 	fgaClient.SetStoreId(storeID)
 
-	// Get the authorization model ID
-	models, err := fgaClient.ReadAuthorizationModels(context.Background()).Execute()
-	if err != nil {
-		log.Fatal("Failed to read authorization models:", err)
+	return fgaClient
+}
+
+// printJSONResult prints the --output json line of a check, with its
+// --timing breakdown unless timing is nil
+func printJSONResult(userID, relation, documentID string, allowed bool, timing *checkTiming) {
+	result := checkResult{
+		Principal: fmt.Sprintf("user:%s", userID),
+		Action:    relation,
+		Resource:  fmt.Sprintf("document:%s", documentID),
+		Decision:  "deny",
+		Timing:    timing,
 	}
-	
-	if len(models.AuthorizationModels) == 0 {
-		log.Fatal("No authorization model found. Please upload the document-management.fga model.")
+	if allowed {
+		result.Decision = "allow"
 	}
-	
-	modelID := models.AuthorizationModels[0].Id
-	fgaClient.SetAuthorizationModelId(modelID)
-
-	// Perform authorization check
-	allowed, err := checkAuthorization(fgaClient, userID, documentID)
+	encoded, err := json.Marshal(result)
 	if err != nil {
-		log.Fatal("Authorization check failed:", err)
+		log.Fatal("Failed to encode result:", err)
 	}
+	fmt.Println(string(encoded))
+}
 
-	// Print result
-	if allowed {
-		fmt.Printf("✅ ALLOWED: %s can view %s\n", userID, documentID)
-	} else {
-		fmt.Printf("❌ DENIED: %s cannot view %s\n", userID, documentID)
+// reportConsistencyDisagreement compares the primary MINIMIZE_LATENCY decision
+// with the HIGHER_CONSISTENCY one and prints any disagreement
+func reportConsistencyDisagreement(userID, relation, documentID string, primary bool, secondary consistencyResult) {
+	if secondary.err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  HIGHER_CONSISTENCY check failed: %v\n", secondary.err)
+		return
+	}
+	if secondary.allowed == primary {
+		fmt.Println("🔁 HIGHER_CONSISTENCY agrees")
+		return
 	}
+	fmt.Printf("⚠️  CONSISTENCY DISAGREEMENT at %s: user:%s %s document:%s MINIMIZE_LATENCY=%t HIGHER_CONSISTENCY=%t\n",
+		secondary.at.UTC().Format(time.RFC3339Nano), userID, relation, documentID, primary, secondary.allowed)
 }
 
-// checkAuthorization performs OpenFGA authorization check
-func checkAuthorization(fgaClient *client.OpenFgaClient, userID, documentID string) (bool, error) {
+// checkRequest is a check of a relation of a user on a document
+type checkRequest struct {
+	UserID     string
+	Relation   string
+	DocumentID string
+	// Context is the condition context of checkContext, which time-bounded
+	// shares and MFA-gated deletes are evaluated with
+	Context     map[string]interface{}
+	Consistency openfga.ConsistencyPreference
+}
+
+// checkAuthorization performs the OpenFGA authorization check of request
+func checkAuthorization(ctx context.Context, fgaClient *client.OpenFgaClient, request checkRequest) (bool, error) {
 	// Create check request
 	body := client.ClientCheckRequest{
-		User:     fmt.Sprintf("user:%s", userID),
-		Relation: "can_view",
-		Object:   fmt.Sprintf("document:%s", documentID),
+		User:     fmt.Sprintf("user:%s", request.UserID),
+		Relation: request.Relation,
+		Object:   fmt.Sprintf("document:%s", request.DocumentID),
+		Context:  &request.Context,
+	}
+	options := client.ClientCheckOptions{
+		Consistency: &request.Consistency,
 	}
 
 	// Execute check
-	data, err := fgaClient.Check(context.Background()).Body(body).Execute()
+	data, err := fgaClient.Check(ctx).Body(body).Options(options).Execute()
 	if err != nil {
+		var validationErr openfga.FgaApiValidationError
+		if errors.As(err, &validationErr) && isModelError(validationErr) {
+			return false, fmt.Errorf("%w: %s", ErrModelError, validationErr.Error())
+		}
 		return false, fmt.Errorf("check request failed: %w", err)
 	}
 
 	return *data.Allowed, nil
 }
+
+// isModelError reports whether a validation error was caused by the request
+// referencing a type or relation that is missing from the model
+func isModelError(err openfga.FgaApiValidationError) bool {
+	switch err.ResponseCode() {
+	case openfga.ERRORCODE_RELATION_NOT_FOUND, openfga.ERRORCODE_TYPE_NOT_FOUND, openfga.ERRORCODE_UNKNOWN_RELATION:
+		return true
+	case openfga.ERRORCODE_VALIDATION_ERROR:
+		// The server reports unknown relations in Check as generic validation
+		// errors, e.g. "relation 'document#can_view' not found"
+		if response, ok := err.Model().(openfga.ValidationErrorMessageResponse); ok {
+			return strings.Contains(response.GetMessage(), "not found")
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+// modelChange is one structural difference between two authorization models
+type modelChange struct {
+	Op      string // "+" added, "-" removed, "~" changed
+	Subject string // e.g. "type team", "folder#editor" or "condition non_expired"
+	Detail  string // the definition, or "old -> new" for changes
+}
+
+func (c modelChange) String() string {
+	if c.Detail == "" {
+		return c.Op + " " + c.Subject
+	}
+	return fmt.Sprintf("%s %s: %s", c.Op, c.Subject, c.Detail)
+}
+
+// diffModels compares the types, relations and conditions of two models.
+// Relations are compared by their DSL rendering, which covers both the
+// rewrite and the directly related user types.
+func diffModels(from, to *openfga.AuthorizationModel) []modelChange {
+	var changes []modelChange
+	fromTypes, toTypes := typeDefinitions(from), typeDefinitions(to)
+	for _, name := range sortedUnion(fromTypes, toTypes) {
+		before, inFrom := fromTypes[name]
+		after, inTo := toTypes[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, modelChange{Op: "+", Subject: "type " + name})
+		case !inTo:
+			changes = append(changes, modelChange{Op: "-", Subject: "type " + name})
+			continue
+		}
+
+		fromRelations, toRelations := relationDefinitions(before), relationDefinitions(after)
+		for _, relation := range sortedUnion(fromRelations, toRelations) {
+			subject := name + "#" + relation
+			oldDef, inFrom := fromRelations[relation]
+			newDef, inTo := toRelations[relation]
+			switch {
+			case !inFrom:
+				changes = append(changes, modelChange{Op: "+", Subject: subject, Detail: newDef})
+			case !inTo:
+				changes = append(changes, modelChange{Op: "-", Subject: subject, Detail: oldDef})
+			case oldDef != newDef:
+				changes = append(changes, modelChange{Op: "~", Subject: subject, Detail: oldDef + " -> " + newDef})
+			}
+		}
+	}
+
+	fromConditions, toConditions := conditions(from), conditions(to)
+	for _, name := range sortedUnion(fromConditions, toConditions) {
+		subject := "condition " + name
+		before, inFrom := fromConditions[name]
+		after, inTo := toConditions[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, modelChange{Op: "+", Subject: subject, Detail: after.Expression})
+		case !inTo:
+			changes = append(changes, modelChange{Op: "-", Subject: subject, Detail: before.Expression})
+		case before.Expression != after.Expression:
+			changes = append(changes, modelChange{Op: "~", Subject: subject, Detail: before.Expression + " -> " + after.Expression})
+		case conditionParameters(before) != conditionParameters(after):
+			changes = append(changes, modelChange{Op: "~", Subject: subject, Detail: "parameters " + conditionParameters(before) + " -> " + conditionParameters(after)})
+		}
+	}
+	return changes
+}
+
+func typeDefinitions(model *openfga.AuthorizationModel) map[string]openfga.TypeDefinition {
+	types := make(map[string]openfga.TypeDefinition, len(model.TypeDefinitions))
+	for _, def := range model.TypeDefinitions {
+		types[def.Type] = def
+	}
+	return types
+}
+
+// relationDefinitions renders every relation of a type in the DSL syntax
+func relationDefinitions(def openfga.TypeDefinition) map[string]string {
+	relations := make(map[string]string)
+	for name, rewrite := range def.GetRelations() {
+		var direct []openfga.RelationReference
+		if metadata, ok := def.GetMetadataOk(); ok {
+			relationMetadata := metadata.GetRelations()[name]
+			direct = relationMetadata.GetDirectlyRelatedUserTypes()
+		}
+		relations[name] = renderUserset(rewrite, direct, false)
+	}
+	return relations
+}
+
+// renderUserset renders a relation rewrite in the DSL syntax, e.g.
+// "[user, team#member] or owner or editor from parent". Nested operators are
+// parenthesized.
+func renderUserset(u openfga.Userset, direct []openfga.RelationReference, nested bool) string {
+	var rendered string
+	switch {
+	case u.This != nil:
+		var types []string
+		for _, ref := range direct {
+			types = append(types, renderRelationReference(ref))
+		}
+		return "[" + strings.Join(types, ", ") + "]"
+	case u.ComputedUserset != nil:
+		return u.ComputedUserset.GetRelation()
+	case u.TupleToUserset != nil:
+		return u.TupleToUserset.ComputedUserset.GetRelation() + " from " + u.TupleToUserset.Tupleset.GetRelation()
+	case u.Union != nil:
+		rendered = renderChildren(u.Union.Child, direct, " or ")
+	case u.Intersection != nil:
+		rendered = renderChildren(u.Intersection.Child, direct, " and ")
+	case u.Difference != nil:
+		rendered = renderUserset(u.Difference.Base, direct, true) + " but not " + renderUserset(u.Difference.Subtract, direct, true)
+	default:
+		return "<unknown rewrite>"
+	}
+	if nested {
+		return "(" + rendered + ")"
+	}
+	return rendered
+}
+
+func renderChildren(children []openfga.Userset, direct []openfga.RelationReference, operator string) string {
+	rendered := make([]string, len(children))
+	for i, child := range children {
+		rendered[i] = renderUserset(child, direct, true)
+	}
+	return strings.Join(rendered, operator)
+}
+
+// renderRelationReference renders a directly related user type, e.g. "user",
+// "team#member", "user:*" or "user with non_expired"
+func renderRelationReference(ref openfga.RelationReference) string {
+	rendered := ref.Type
+	switch {
+	case ref.Relation != nil:
+		rendered += "#" + *ref.Relation
+	case ref.Wildcard != nil:
+		rendered += ":*"
+	}
+	if ref.Condition != nil && *ref.Condition != "" {
+		rendered += " with " + *ref.Condition
+	}
+	return rendered
+}
+
+func conditions(model *openfga.AuthorizationModel) map[string]openfga.Condition {
+	if model.Conditions == nil {
+		return map[string]openfga.Condition{}
+	}
+	return *model.Conditions
+}
+
+// conditionParameters renders the parameters of a condition for comparison
+func conditionParameters(condition openfga.Condition) string {
+	encoded, _ := json.Marshal(condition.GetParameters())
+	return string(encoded)
+}
+
+func sortedUnion[V any](a, b map[string]V) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// modelCreatedAt decodes the creation time embedded in a model ID, which is a
+// ULID whose first 10 characters encode the milliseconds since the epoch
+func modelCreatedAt(id string) (time.Time, bool) {
+	const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	if len(id) != 26 {
+		return time.Time{}, false
+	}
+	var millis int64
+	for _, c := range strings.ToUpper(id[:10]) {
+		digit := strings.IndexRune(crockford, c)
+		if digit < 0 {
+			return time.Time{}, false
+		}
+		millis = millis<<5 | int64(digit)
+	}
+	return time.UnixMilli(millis).UTC(), true
+}
+
+// listModels returns every model of the store, newest first
+func listModels(ctx context.Context, fgaClient *client.OpenFgaClient) ([]openfga.AuthorizationModel, error) {
+	var models []openfga.AuthorizationModel
+	var options client.ClientReadAuthorizationModelsOptions
+	for {
+		page, err := fgaClient.ReadAuthorizationModels(ctx).Options(options).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read authorization models: %w", err)
+		}
+		models = append(models, page.AuthorizationModels...)
+		if page.GetContinuationToken() == "" {
+			return models, nil
+		}
+		token := page.GetContinuationToken()
+		options.ContinuationToken = &token
+	}
+}
+
+// latestModelID returns the ID of the newest model of the store
+func latestModelID(ctx context.Context, fgaClient *client.OpenFgaClient) (string, error) {
+	pageSize := int32(1)
+	page, err := fgaClient.ReadAuthorizationModels(ctx).Options(client.ClientReadAuthorizationModelsOptions{PageSize: &pageSize}).Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to read authorization models: %w", err)
+	}
+	if len(page.AuthorizationModels) == 0 {
+		return "", errors.New("no authorization model found, please upload the document-management.fga model")
+	}
+	return page.AuthorizationModels[0].Id, nil
+}
+
+// loadModel reads a model by ID from the store or, for a path ending in
+// .json, from a model file such as document-management.json. The client is
+// only connected when a model has to be read from the store.
+func loadModel(ctx context.Context, connect func() *client.OpenFgaClient, ref string) (*openfga.AuthorizationModel, error) {
+	if strings.HasSuffix(ref, ".json") {
+		return loadModelFile(os.DirFS(filepath.Dir(ref)), filepath.Base(ref))
+	}
+
+	response, err := connect().ReadAuthorizationModel(ctx).Options(client.ClientReadAuthorizationModelOptions{AuthorizationModelId: &ref}).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization model %s: %w", ref, err)
+	}
+	if response.AuthorizationModel == nil {
+		return nil, fmt.Errorf("authorization model %s not found", ref)
+	}
+	return response.AuthorizationModel, nil
+}
+
+// loadModelFile reads the named model file, in the JSON form of
+// document-management.json, from fsys, which may be the working directory,
+// an embed.FS or any other fs.FS
+func loadModelFile(fsys fs.FS, name string) (*openfga.AuthorizationModel, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open model: %w", err)
+	}
+	defer f.Close()
+	return readModel(name, f)
+}
+
+// readModel parses a model in JSON form from r; name is used in errors
+func readModel(name string, r io.Reader) (*openfga.AuthorizationModel, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	var model openfga.AuthorizationModel
+	if err := json.Unmarshal(src, &model); err != nil {
+		return nil, fmt.Errorf("failed to parse model %s: %w", name, err)
+	}
+	return &model, nil
+}
+
+// runModelCommand implements "openfga-check model list" and
+// "openfga-check model diff <idA> <idB>"
+func runModelCommand(ctx context.Context, connect func() *client.OpenFgaClient, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		models, err := listModels(ctx, connect())
+		if err != nil {
+			return err
+		}
+		for i, model := range models {
+			created := "unknown creation time"
+			if at, ok := modelCreatedAt(model.Id); ok {
+				created = at.Format(time.RFC3339)
+			}
+			latest := ""
+			if i == 0 {
+				latest = "  (latest)"
+			}
+			fmt.Printf("%s  %s%s\n", model.Id, created, latest)
+
+			// Models are listed newest first, so the previous version is next
+			if i == len(models)-1 {
+				fmt.Println("    (first model in the store)")
+				continue
+			}
+			changes := diffModels(&models[i+1], &models[i])
+			if len(changes) == 0 {
+				fmt.Println("    (no structural changes)")
+			}
+			for _, change := range changes {
+				fmt.Printf("    %s\n", change)
+			}
+		}
+		return nil
+
+	case len(args) == 3 && args[0] == "diff":
+		from, err := loadModel(ctx, connect, args[1])
+		if err != nil {
+			return err
+		}
+		to, err := loadModel(ctx, connect, args[2])
+		if err != nil {
+			return err
+		}
+		changes := diffModels(from, to)
+		if len(changes) == 0 {
+			fmt.Printf("✅ No structural differences between %s and %s\n", args[1], args[2])
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		return nil
+	}
+	return errors.New("usage: ./openfga-check model list | model diff <idA|file.json> <idB|file.json>")
+}
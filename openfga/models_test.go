@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+)
+
+// The fixtures in testdata/models are successive versions of a document
+// model, each making one kind of change to the previous one
+func TestDiffModels(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+	}{
+		{
+			name: "unchanged",
+			from: "1-initial", to: "1-initial",
+			want: nil,
+		},
+		{
+			name: "added type",
+			from: "1-initial", to: "2-team-type",
+			want: []string{
+				"+ type team",
+				"+ team#member: [user]",
+			},
+		},
+		{
+			name: "removed type",
+			from: "2-team-type", to: "1-initial",
+			want: []string{
+				"- type team",
+			},
+		},
+		{
+			name: "union to difference",
+			from: "2-team-type", to: "3-blocked-viewers",
+			want: []string{
+				"+ document#blocked: [user]",
+				"~ document#viewer: [user] or owner or member from organization -> ([user] or owner or member from organization) but not blocked",
+			},
+		},
+		{
+			name: "direct types",
+			from: "3-blocked-viewers", to: "4-expiring-public-viewers",
+			want: []string{
+				"~ document#viewer: ([user] or owner or member from organization) but not blocked -> ([user with non_expired, user:*] or owner or member from organization) but not blocked",
+				"+ condition non_expired: current_time < expires_at",
+			},
+		},
+		{
+			name: "condition expression",
+			from: "4-expiring-public-viewers", to: "5-inclusive-expiry",
+			want: []string{
+				"~ condition non_expired: current_time < expires_at -> current_time <= expires_at",
+			},
+		},
+		{
+			name: "condition parameters",
+			from: "5-inclusive-expiry", to: "6-string-expiry",
+			want: []string{
+				`~ condition non_expired: parameters {"current_time":{"type_name":"TYPE_NAME_TIMESTAMP"},"expires_at":{"type_name":"TYPE_NAME_TIMESTAMP"}} -> {"current_time":{"type_name":"TYPE_NAME_TIMESTAMP"},"expires_at":{"type_name":"TYPE_NAME_STRING"}}`,
+			},
+		},
+		{
+			name: "removed condition",
+			from: "6-string-expiry", to: "3-blocked-viewers",
+			want: []string{
+				"~ document#viewer: ([user with non_expired, user:*] or owner or member from organization) but not blocked -> ([user] or owner or member from organization) but not blocked",
+				"- condition non_expired: current_time <= expires_at",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := loadModelFixture(t, tt.from)
+			to := loadModelFixture(t, tt.to)
+			var got []string
+			for _, change := range diffModels(from, to) {
+				got = append(got, change.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("diff %s -> %s:\ngot  %q\nwant %q", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Every relation of document-management.json renders as it is defined in
+// document-management.fga, which the JSON is compiled from
+func TestRenderDocumentManagementModel(t *testing.T) {
+	model, err := loadModel(context.Background(), nil, "document-management.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile("document-management.fga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defined := 0
+	var typeName string
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "type "); ok {
+			typeName = name
+			continue
+		}
+		definition, ok := strings.CutPrefix(line, "define ")
+		if !ok {
+			continue
+		}
+		relation, want, _ := strings.Cut(definition, ": ")
+		got := relationDefinitions(typeDefinitions(model)[typeName])[relation]
+		if got != want {
+			t.Errorf("%s#%s rendered as %q, want %q", typeName, relation, got, want)
+		}
+		defined++
+	}
+	if defined == 0 {
+		t.Fatal("no relations found in document-management.fga")
+	}
+}
+
+// embeddedModel holds the model the way an application would ship it inside
+// its binary
+//
+//go:embed document-management.json
+var embeddedModel embed.FS
+
+func TestLoadEmbeddedModel(t *testing.T) {
+	model, err := loadModelFile(embeddedModel, "document-management.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relations, err := documentPermissions(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"can_delete", "can_edit", "can_share", "can_view"}; !slices.Equal(relations, want) {
+		t.Errorf("got document permissions %v, want %v", relations, want)
+	}
+
+	onDisk, err := loadModel(context.Background(), nil, "document-management.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := diffModels(onDisk, model); len(changes) > 0 {
+		t.Errorf("embedded model differs from the file: %v", changes)
+	}
+}
+
+func loadModelFixture(t *testing.T, name string) *openfga.AuthorizationModel {
+	t.Helper()
+	model, err := loadModel(context.Background(), nil, filepath.Join("testdata", "models", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
@@ -76,11 +76,30 @@ curl -s -X POST "http://localhost:8080/stores/$STORE_ID/write" \
       {"user": "user:charlie", "relation": "member", "object": "organization:org1"},
       {"user": "user:david", "relation": "member", "object": "organization:org2"},
       {"user": "user:eve", "relation": "member", "object": "organization:org2"},
+      {"user": "user:frank", "relation": "member", "object": "organization:org2"},
+      {"user": "user:grace", "relation": "member", "object": "organization:org1"},
+      {"user": "user:henry", "relation": "member", "object": "organization:org1"},
+      {"user": "user:henry", "relation": "admin", "object": "organization:org1"},
+      {"user": "user:david", "relation": "admin", "object": "organization:org2"},
+      {"user": "user:henry", "relation": "mfa_admin", "object": "organization:org1", "condition": {"name": "mfa_verified"}},
+      {"user": "user:david", "relation": "mfa_admin", "object": "organization:org2", "condition": {"name": "mfa_verified"}},
+      
+      {"user": "organization:org1", "relation": "organization", "object": "workspace:ws1"},
+      {"user": "user:grace", "relation": "admin", "object": "workspace:ws1"},
       
       {"user": "organization:org1", "relation": "organization", "object": "folder:folder1"},
       {"user": "user:alice", "relation": "owner", "object": "folder:folder1"},
+      {"user": "workspace:ws1", "relation": "workspace", "object": "folder:folder1"},
       {"user": "organization:org2", "relation": "organization", "object": "folder:folder2"},
       {"user": "user:david", "relation": "owner", "object": "folder:folder2"},
+      {"user": "organization:org1", "relation": "organization", "object": "folder:folder3"},
+      {"user": "user:alice", "relation": "owner", "object": "folder:folder3"},
+      {"user": "organization:org1", "relation": "organization", "object": "folder:folder4"},
+      {"user": "user:alice", "relation": "owner", "object": "folder:folder4"},
+      {"user": "folder:folder3", "relation": "parent", "object": "folder:folder4"},
+      {"user": "organization:org1", "relation": "organization", "object": "folder:folder5"},
+      {"user": "user:alice", "relation": "owner", "object": "folder:folder5"},
+      {"user": "folder:folder4", "relation": "parent", "object": "folder:folder5"},
       
       {"user": "organization:org1", "relation": "organization", "object": "document:doc1"},
       {"user": "user:alice", "relation": "owner", "object": "document:doc1"},
@@ -97,12 +116,32 @@ curl -s -X POST "http://localhost:8080/stores/$STORE_ID/write" \
       {"user": "organization:org1", "relation": "organization", "object": "document:doc4"},
       {"user": "user:alice", "relation": "owner", "object": "document:doc4"},
       
+      {"user": "organization:org1", "relation": "organization", "object": "document:doc5"},
+      {"user": "user:frank", "relation": "owner", "object": "document:doc5"},
+      {"user": "folder:folder1", "relation": "parent_folder", "object": "document:doc5"},
+      
+      {"user": "organization:org1", "relation": "organization", "object": "document:doc6"},
+      {"user": "user:alice", "relation": "owner", "object": "document:doc6"},
+      {"user": "folder:folder5", "relation": "parent_folder", "object": "document:doc6"},
+      
+      {"user": "organization:org2", "relation": "organization", "object": "document:doc7"},
+      {"user": "user:david", "relation": "owner", "object": "document:doc7"},
+      {"user": "folder:folder2", "relation": "parent_folder", "object": "document:doc7"},
+      {"user": "user:*", "relation": "viewer", "object": "document:doc7"},
+      
       {"user": "user:charlie", "relation": "viewer", "object": "document:doc2"},
       {"user": "user:bob", "relation": "editor", "object": "document:doc4"},
       {"user": "user:charlie", "relation": "viewer", "object": "document:doc4"},
+      {"user": "user:eve", "relation": "editor", "object": "document:doc2"},
+      {"user": "user:david", "relation": "viewer", "object": "document:doc4", "condition": {"name": "non_expired", "context": {"expires_at": "2026-01-01T00:00:00Z"}}},
       
       {"user": "user:bob", "relation": "viewer", "object": "folder:folder1"},
-      {"user": "user:eve", "relation": "editor", "object": "folder:folder2"}
+      {"user": "user:eve", "relation": "editor", "object": "folder:folder2"},
+      {"user": "user:eve", "relation": "viewer", "object": "folder:folder3"},
+      
+      {"user": "user:frank", "relation": "member", "object": "team:apollo"},
+      {"user": "team:apollo#member", "relation": "viewer", "object": "document:doc2"},
+      {"user": "team:apollo#member", "relation": "editor", "object": "folder:folder4"}
     ]
   }
 }
@@ -114,11 +153,13 @@ echo "📥 Installing Go dependencies..."
 go mod tidy
 
 echo "🔨 Building the application..."
-go build -o openfga-check main.go
+go build -o openfga-check .
 
 # Export environment variables for the application
 export OPENFGA_STORE_ID=$STORE_ID
+export OPENFGA_MODEL_ID=$MODEL_ID
 echo "export OPENFGA_STORE_ID=$STORE_ID" > .env
+echo "export OPENFGA_MODEL_ID=$MODEL_ID" >> .env
 
 echo "✅ Setup complete!"
 echo ""
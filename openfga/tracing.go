@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"checktable"
+)
+
+// serverDurationHeader is the response header OpenFGA uses to report how long
+// the server spent evaluating the request
+const serverDurationHeader = "fga-query-duration-ms"
+
+// callTiming holds the latency breakdown of a single HTTP call to OpenFGA
+type callTiming struct {
+	Method          string
+	Path            string
+	DNS             time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	BodyRead        time.Duration
+	Total           time.Duration
+	ServerTime      *time.Duration // nil when the server doesn't report it
+	ConnReused      bool
+}
+
+// tracingTransport is an http.RoundTripper that uses httptrace to record
+// where the time of every OpenFGA call goes
+type tracingTransport struct {
+	base  http.RoundTripper
+	mu    sync.Mutex
+	calls []*callTiming
+}
+
+func newTracingTransport(base http.RoundTripper) *tracingTransport {
+	return &tracingTransport{base: base}
+}
+
+// RoundTrip executes the request while recording DNS, connect, TLS, time to
+// first byte and body read durations
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing := &callTiming{Method: req.Method, Path: req.URL.Path}
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { timing.DNS = time.Since(dnsStart) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { timing.Connect = time.Since(connectStart) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timing.TLSHandshake = time.Since(tlsStart) },
+		GotConn:              func(info httptrace.GotConnInfo) { timing.ConnReused = info.Reused },
+		GotFirstResponseByte: func() { timing.TimeToFirstByte = time.Since(start) },
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+
+	if value := resp.Header.Get(serverDurationHeader); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil {
+			serverTime := time.Duration(ms * float64(time.Millisecond))
+			timing.ServerTime = &serverTime
+		}
+	}
+
+	// The body is read by the SDK after RoundTrip returns, so measure it when
+	// the body is closed. That can happen while the calls are printed, e.g.
+	// for the cancelled loser of a hedged check, so it takes the lock too.
+	bodyStart := time.Now()
+	resp.Body = &timedBody{ReadCloser: resp.Body, onClose: func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		timing.BodyRead = time.Since(bodyStart)
+		timing.Total = time.Since(start)
+	}}
+
+	t.mu.Lock()
+	t.calls = append(t.calls, timing)
+	t.mu.Unlock()
+
+	return resp, nil
+}
+
+// timedBody invokes onClose once when the response body is closed
+type timedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(b.onClose)
+	return b.ReadCloser.Close()
+}
+
+// printLatencyBreakdown prints one line per recorded call and the connection
+// reuse rate, which should be high when keep-alive is working
+func (t *tracingTransport) printLatencyBreakdown() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reused := 0
+	fmt.Println("⏱️  OpenFGA latency breakdown:")
+	for _, c := range t.calls {
+		server := "n/a"
+		if c.ServerTime != nil {
+			server = formatMillis(*c.ServerTime)
+		}
+		fmt.Printf("   %s %s dns=%s connect=%s tls=%s ttfb=%s body=%s server=%s total=%s reused=%t\n",
+			c.Method, c.Path, formatMillis(c.DNS), formatMillis(c.Connect), formatMillis(c.TLSHandshake),
+			formatMillis(c.TimeToFirstByte), formatMillis(c.BodyRead), server, formatMillis(c.Total), c.ConnReused)
+		if c.ConnReused {
+			reused++
+		}
+	}
+	if len(t.calls) > 0 {
+		fmt.Printf("   connection reuse: %d/%d calls (%.0f%%)\n", reused, len(t.calls), 100*float64(reused)/float64(len(t.calls)))
+	}
+}
+
+// formatMillis renders a duration in milliseconds with two decimals
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+// checkTiming is the --timing breakdown of a check. OpenFGA evaluates on the
+// server, so the round trip is the whole check; the fields line up with
+// cedar-check's query, entity build and eval timings.
+type checkTiming struct {
+	RoundTrip time.Duration
+}
+
+func (t *checkTiming) String() string {
+	return fmt.Sprintf("round_trip=%s total=%s", checktable.FormatLatency(t.RoundTrip), checktable.FormatLatency(t.RoundTrip))
+}
+
+// MarshalJSON encodes the durations in milliseconds, like cedar-check
+func (t *checkTiming) MarshalJSON() ([]byte, error) {
+	ms := float64(t.RoundTrip) / float64(time.Millisecond)
+	return json.Marshal(struct {
+		RoundTrip float64 `json:"round_trip_ms"`
+		Total     float64 `json:"total_ms"`
+	}{ms, ms})
+}